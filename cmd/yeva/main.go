@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -28,6 +29,7 @@ func main() {
 		err = runFile(os.Args[1:])
 	}
 	if err != nil {
+		printError(err)
 		os.Exit(1)
 	}
 }
@@ -39,16 +41,18 @@ func runFile(args []string) error {
 		return fmt.Errorf("run file: %w", err)
 	}
 	e := yv.New()
-	argv := &yv.Doc{Pairs: make(map[yv.Value]yv.Value, len(args))}
-	for i, arg := range args {
-		argv.Pairs[yv.Num(i)] = yv.Str(arg)
+	argv, err := yv.FromGo(args)
+	if err != nil {
+		return fmt.Errorf("run file: %w", err)
 	}
 	e.Globals["argv"] = argv
-	return e.Interpret(source)
+	e.Loader = yv.FileLoader{}
+	return e.InterpretFile(scriptPath, source)
 }
 
 func runRepl() error {
 	vm := yv.New()
+	vm.Loader = yv.FileLoader{}
 	fmt.Printf("Yeva %s\n", yv.Version)
 	fmt.Println("exit using ctrl+c")
 	for {
@@ -61,7 +65,18 @@ func runRepl() error {
 			return fmt.Errorf("run repl: %w", err)
 		}
 		source = source[:len(source)-1] // remove delim
-		vm.Interpret(source)
+		if err := vm.InterpretFile("<stdin>", source); err != nil {
+			printError(err)
+		}
+	}
+}
+
+func printError(err error) {
+	var exc *yv.RuntimeException
+	if errors.As(err, &exc) {
+		fmt.Fprintln(os.Stderr, exc.Traceback())
+	} else {
+		fmt.Fprintln(os.Stderr, err)
 	}
 }
 
@@ -0,0 +1,273 @@
+package yeva
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+var protoArray Prototype = protoOf(map[Value]Value{
+	Str("length"): arrayMethod("length", func(a *Array) int {
+		return len(a.Elems)
+	}),
+	Str("push"): arrayMethod("push", func(e *Evaluator, a *Array, vals ...Value) {
+		e.alloc(len(vals) * valueSize)
+		a.Elems = append(a.Elems, vals...)
+	}),
+	Str("pop"): arrayMethod("pop", func(a *Array, at ...int) (Value, error) {
+		if len(a.Elems) == 0 {
+			return nil, newError("IndexError", "pop from empty list")
+		}
+		i := len(a.Elems) - 1
+		if len(at) > 0 {
+			i = at[0]
+			if i < 0 {
+				i += len(a.Elems)
+			}
+			if i < 0 || i >= len(a.Elems) {
+				return nil, newError("IndexError", "pop index %d out of range", at[0])
+			}
+		}
+		v := a.Elems[i]
+		a.Elems = slices.Delete(a.Elems, i, i+1)
+		return v, nil
+	}),
+	Str("insert"): arrayMethod("insert", func(e *Evaluator, a *Array, i int, v Value) {
+		e.alloc(valueSize)
+		a.Elems = slices.Insert(a.Elems, clampIndex(i, len(a.Elems)), v)
+	}),
+	Str("remove"): arrayMethod("remove", func(e *Evaluator, a *Array, v Value) error {
+		i := indexOf(e, a.Elems, v)
+		if i < 0 {
+			return newError("ValueError", "%v is not in list", v)
+		}
+		a.Elems = slices.Delete(a.Elems, i, i+1)
+		return nil
+	}),
+	Str("slice"): arrayMethod("slice", func(e *Evaluator, a *Array, start int, end ...int) *Array {
+		n := len(a.Elems)
+		stop := n
+		if len(end) > 0 {
+			stop = end[0]
+		}
+		start, stop = clampIndex(start, n), clampIndex(stop, n)
+		if stop < start {
+			stop = start
+		}
+		return newArray(e, slices.Clone(a.Elems[start:stop]))
+	}),
+	Str("concat"): arrayMethod("concat", func(e *Evaluator, a *Array, arrs ...*Array) *Array {
+		elems := slices.Clone(a.Elems)
+		for _, arr := range arrs {
+			elems = append(elems, arr.Elems...)
+		}
+		return newArray(e, elems)
+	}),
+	Str("index_of"): arrayMethod("index_of", func(e *Evaluator, a *Array, v Value) int {
+		return indexOf(e, a.Elems, v)
+	}),
+	Str("reverse"): arrayMethod("reverse", func(a *Array) {
+		slices.Reverse(a.Elems)
+	}),
+	Str("sort"): arrayMethod("sort", sortArray),
+	Str("map"): arrayMethod("map", func(e *Evaluator, a *Array, fn Callable) (*Array, error) {
+		elems := make([]Value, len(a.Elems))
+		for i, v := range a.Elems {
+			res, err := e.Call(fn, []Value{v})
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = first(res)
+		}
+		return newArray(e, elems), nil
+	}),
+	Str("filter"): arrayMethod("filter", func(e *Evaluator, a *Array, fn Callable) (*Array, error) {
+		elems := []Value{}
+		for _, v := range a.Elems {
+			res, err := e.Call(fn, []Value{v})
+			if err != nil {
+				return nil, err
+			}
+			if e.truthy(first(res)) {
+				elems = append(elems, v)
+			}
+		}
+		return newArray(e, elems), nil
+	}),
+	Str("reduce"): arrayMethod("reduce", func(e *Evaluator, a *Array, fn Callable, init ...Value) (Value, error) {
+		elems := a.Elems
+		if len(init) > 0 {
+			elems = append([]Value{init[0]}, elems...)
+		}
+		if len(elems) == 0 {
+			return nil, newError("TypeError", "reduce() of empty list with no initial value")
+		}
+		acc := elems[0]
+		for _, v := range elems[1:] {
+			res, err := e.Call(fn, []Value{acc, v})
+			if err != nil {
+				return nil, err
+			}
+			acc = first(res)
+		}
+		return acc, nil
+	}),
+	Str("any"): arrayMethod("any", func(e *Evaluator, a *Array, fn ...Callable) (bool, error) {
+		return testArray(e, a, fn, true)
+	}),
+	Str("all"): arrayMethod("all", func(e *Evaluator, a *Array, fn ...Callable) (bool, error) {
+		return testArray(e, a, fn, false)
+	}),
+	Str("join"): arrayMethod("join", func(e *Evaluator, a *Array, sep ...string) string {
+		parts := make([]string, len(a.Elems))
+		for i, v := range a.Elems {
+			parts[i] = e.toStr(v)
+		}
+		res := strings.Join(parts, strings.Join(sep, ""))
+		e.alloc(len(res))
+		return res
+	}),
+})
+
+func isArray(v Value) bool {
+	_, ok := v.(*Array)
+	return ok
+}
+
+func arrayMethod(name string, fn any) *NativeFunc {
+	return wrapMethod(name, "a list", isArray, fn)
+}
+
+func newArray(e *Evaluator, elems []Value) *Array {
+	e.alloc(len(elems) * valueSize)
+	return &Array{Elems: elems}
+}
+
+func first(vals []Value) Value {
+	if len(vals) == 0 {
+		return None{}
+	}
+	return vals[0]
+}
+
+func indexOf(e *Evaluator, vals []Value, v Value) int {
+	for i, elem := range vals {
+		if e.equal(elem, v) {
+			return i
+		}
+	}
+	return -1
+}
+
+// clampIndex turns a negative index into one from the end and keeps
+// it in 0..n.
+func clampIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	return min(max(i, 0), n)
+}
+
+// testArray tells whether any (or all when any is false) elements pass
+// the test, the elements themselves are tested without one.
+func testArray(e *Evaluator, a *Array, test []Callable, any bool) (bool, error) {
+	for _, v := range a.Elems {
+		if len(test) > 0 {
+			res, err := e.Call(test[0], []Value{v})
+			if err != nil {
+				return false, err
+			}
+			v = first(res)
+		}
+		if bool(e.truthy(v)) == any {
+			return any, nil
+		}
+	}
+	return !any, nil
+}
+
+// sortArray sorts an array in place by the keys given by key, or by the
+// elements without it. cmp compares two keys and returns a number
+// below, equal to or above zero, numbers, strings and values with
+// '__lt__' are compared without it.
+func sortArray(e *Evaluator, a *Array, fns ...Value) error {
+	if len(fns) > 2 {
+		return newError("TypeError", "sort() takes at most 2 arguments")
+	}
+	var key, cmp Callable
+	for i, fn := range fns {
+		if isNone(fn) {
+			continue
+		}
+		c, ok := fn.(Callable)
+		if !ok {
+			return newError("TypeError", "sort() argument %d must be a function", i+1)
+		}
+		if i == 0 {
+			key = c
+		} else {
+			cmp = c
+		}
+	}
+
+	elems := a.Elems
+	keys := elems
+	if key != nil {
+		keys = make([]Value, len(elems))
+		for i, v := range elems {
+			res, err := e.Call(key, []Value{v})
+			if err != nil {
+				return err
+			}
+			keys[i] = first(res)
+		}
+	}
+	order := make([]int, len(elems))
+	for i := range order {
+		order[i] = i
+	}
+	var err error
+	sort.SliceStable(order, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		a, b := keys[order[i]], keys[order[j]]
+		if cmp == nil {
+			var c int
+			c, err = e.compare(a, b)
+			return c < 0
+		}
+		var res []Value
+		res, err = e.Call(cmp, []Value{a, b})
+		if err != nil {
+			return false
+		}
+		c, ok := compareNums(first(res), Int(0))
+		if !ok {
+			err = newError("TypeError", "sort() comparator must return a number")
+		}
+		return c < 0
+	})
+	if err != nil {
+		return err
+	}
+	sorted := make([]Value, len(elems))
+	for i, at := range order {
+		sorted[i] = elems[at]
+	}
+	a.Elems = sorted
+	return nil
+}
+
+func compareValues(a, b Value) (int, error) {
+	if c, ok := compareNums(a, b); ok {
+		return c, nil
+	}
+	switch a := a.(type) {
+	case Str:
+		if b, ok := b.(Str); ok {
+			return strings.Compare(string(a), string(b)), nil
+		}
+	}
+	return 0, newError("TypeError", "can't compare %s and %s", typeName(a), typeName(b))
+}
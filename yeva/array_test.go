@@ -0,0 +1,59 @@
+package yeva
+
+import "testing"
+
+func TestArrayMethods(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"push and pop", `
+x = [1]
+x->push(2)
+x->push(3)
+x->pop()
+`, `[1, 2]`},
+		{"insert and remove", `
+x = [1, 3]
+x->insert(1, 2)
+x->remove(3)
+`, `[1, 2]`},
+		{"concat", `x = [1]->concat([2, 3])`, `[1, 2, 3]`},
+		{"index_of", `x = [[1, 2]->index_of(2), [1]->index_of(5)]`, `[1, -1]`},
+		{"reverse", `
+x = [1, 2, 3]
+x->reverse()
+`, `[3, 2, 1]`},
+		{"sort", `
+x = [3, 1, 2]
+x->sort()
+`, `[1, 2, 3]`},
+		{"sort key", `
+x = ["ccc", "a", "bb"]
+x->sort(lambda s: s->length())
+`, `["a", "bb", "ccc"]`},
+		{"map filter reduce", `
+xs = [1, 2, 3, 4]
+x = xs->map(lambda v: v * 10)->filter(lambda v: v > 10)->reduce(lambda a b: a + b, 0)
+`, "90"},
+		{"any and all", `x = [[1, 2]->any(lambda v: v > 1), [1, 2]->all(lambda v: v > 1)]`, `[True, False]`},
+		{"join", `x = ["a", "b"]->join(", ")`, `"a, b"`},
+		{"length", `x = [1, 2, 3]->length()`, "3"},
+		{"negative index", `x = [1, 2, 3][-1]`, "3"},
+		{"append by assignment", `
+x = [1]
+x[1] = 2
+`, `[1, 2]`},
+	})
+}
+
+func TestArrayIndexErrors(t *testing.T) {
+	for _, source := range []string{
+		`x = [1, 2][2]`,
+		`x = [1, 2][-3]`,
+		`x = [1, 2][1.5]`,
+		`x = [1, 2]
+x[5] = 1`,
+	} {
+		if err := New().Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%q) didn't fail", source)
+		}
+	}
+}
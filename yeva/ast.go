@@ -2,12 +2,12 @@ package yeva
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 )
 
 type astNode interface {
 	astNode()
+	pos() position
 }
 
 type astStmt interface {
@@ -20,127 +20,262 @@ type astExpr interface {
 	astExpr()
 }
 
+type position struct {
+	line int
+	col  int
+}
+
+func (p position) pos() position { return p }
+
+func (p position) String() string {
+	return fmt.Sprintf("line %d:%d", p.line, p.col)
+}
+
 /* == statements ============================================================ */
 
 type badStmt string
 
 type declStmt struct {
+	position
 	varType
 	vars []varName
 }
 
 type decoStmt struct {
+	position
 	deco astExpr
 	def  *defStmt
 }
 
 type defStmt struct {
+	position
 	name   string
 	params []varName
 	body   []astStmt
+	ref    varRef
+	locals int
 }
 
 type exprStmt struct {
+	position
 	expr astExpr
 }
 
 type raiseStmt struct {
+	position
 	exc astExpr
 }
 
 type tryStmt struct {
+	position
 	try     []astStmt
 	except  []astStmt // can be nil
 	as      varName
+	asRef   varRef
 	finally []astStmt // can be nil
 }
 
 type ifStmt struct {
+	position
 	cond  astExpr
 	then  []astStmt
 	else_ []astStmt
 }
 
 type forStmt struct {
+	position
 	loop []astStmt
 	vars []varName
+	refs []varRef
 	in   astExpr
 }
 
 type whileStmt struct {
+	position
 	loop []astStmt
 	cond astExpr
 }
 
 type returnStmt struct {
+	position
 	values []astExpr
 }
 
-type breakStmt struct{}
+type breakStmt struct {
+	position
+}
 
-type continueStmt struct{}
+type continueStmt struct {
+	position
+}
+
+type importStmt struct {
+	position
+	module string
+	as     varName
+	ref    varRef
+}
+
+type fromImportStmt struct {
+	position
+	module string
+	names  []string
+	vars   []varName // names bound in the importing scope
+	refs   []varRef
+}
 
 type assignStmt struct {
+	position
 	lefts  []astExpr
 	rights []astExpr
 }
 
+// augAssignStmt is 'left op= right', op is the token of the operator.
+type augAssignStmt struct {
+	position
+	left  astExpr
+	op    token
+	right astExpr
+}
+
 /* == expression ============================================================ */
 
 type infixExpr struct {
+	position
 	left    astExpr
 	right   astExpr
 	opToken token
 }
 
+// compareExpr is a chain of comparisons like 'a < b <= c', each operand
+// is evaluated once.
+type compareExpr struct {
+	position
+	operands []astExpr
+	ops      []token
+}
+
 type prefixExpr struct {
+	position
 	right   astExpr
 	opToken token
 }
 
 type callExpr struct {
+	position
 	left astExpr
 	args []astExpr
 }
 
 type indexExpr struct {
-	left  astExpr
-	index astExpr
+	position
+	left     astExpr
+	index    astExpr
+	item     bool // 'a[i]' rather than 'a.i'
+	optional bool // 'a?.i'
+}
+
+// sliceExpr is 'a[start:stop:step]', bounds left out are nil.
+type sliceExpr struct {
+	position
+	left              astExpr
+	start, stop, step astExpr
 }
 
 type arrowExpr struct {
+	position
+	left     astExpr
+	index    astExpr
+	optional bool // 'a?->i'
+}
+
+// optChain is a chain of calls and indexes with optional links, it gives
+// None as soon as the left of an optional link is None.
+type optChain struct {
+	position
+	expr astExpr
+}
+
+// condExpr is 'then if cond else else_'.
+type condExpr struct {
+	position
+	cond  astExpr
+	then  astExpr
+	else_ astExpr
+}
+
+// walrusExpr is '(target := value)'.
+type walrusExpr struct {
+	position
+	target *ident
+	value  astExpr
+}
+
+// coalesceExpr is 'left ?? right', right is evaluated when left is None.
+type coalesceExpr struct {
+	position
 	left  astExpr
-	index astExpr
+	right astExpr
 }
 
 type protoDictExpr struct {
+	position
 	proto astExpr
 	dict  *dictLit
 }
 
 type ident struct {
+	position
 	name varName
+	ref  varRef
 }
 
-type noneLit struct{}
+type noneLit struct {
+	position
+}
 
 type boolLit struct {
+	position
 	value bool
 }
 
 type numLit struct {
-	value float64
+	position
+	value Value // Num, Int, BigInt or Decimal
 }
 
 type strLit struct {
+	position
 	value string
 }
 
+// fStrLit is an f-string, its parts are *strLit and *formatExpr.
+type fStrLit struct {
+	position
+	parts []astExpr
+}
+
+// formatExpr is a '{value!conv:spec}' part of an f-string.
+type formatExpr struct {
+	position
+	value astExpr
+	conv  byte // 'r', 's' or 0
+	spec  string
+}
+
 type dictLit struct {
-	pairs map[astExpr]astExpr
+	position
+	keys []astExpr
+	vals []astExpr
 }
 
 type listLit struct {
+	position
+	elems []astExpr
+}
+
+type tupleLit struct {
+	position
 	elems []astExpr
 }
 
@@ -148,67 +283,125 @@ type lambdaLit struct {
 	*defStmt
 }
 
+type compKind int
+
+const (
+	compList compKind = iota
+	compDict
+	compGen
+)
+
+// compIter is the parameter of a comprehension function, the iterable of
+// the first loop which is evaluated outside of it.
+const compIter varName = "(iter)"
+
+// compExpr is a list, dict or generator comprehension. Its loops and
+// conditions are the body of a function of their own ending in a compStmt.
+type compExpr struct {
+	*defStmt
+	kind compKind
+	in   astExpr
+}
+
+// compStmt adds the value, or the key and the value, to the result of a
+// comprehension or yields the value of a generator.
+type compStmt struct {
+	position
+	kind  compKind
+	key   astExpr // nil unless kind is compDict
+	value astExpr
+}
+
 /* == marks ================================================================= */
 
-func (n badStmt) astStmt()       {}
-func (n *decoStmt) astStmt()     {}
-func (n *defStmt) astStmt()      {}
-func (n *exprStmt) astStmt()     {}
-func (n *ifStmt) astStmt()       {}
-func (n *forStmt) astStmt()      {}
-func (n *whileStmt) astStmt()    {}
-func (n *returnStmt) astStmt()   {}
-func (n *breakStmt) astStmt()    {}
-func (n *continueStmt) astStmt() {}
-func (n *assignStmt) astStmt()   {}
-func (n *raiseStmt) astStmt()    {}
-func (n *tryStmt) astStmt()      {}
-func (n *declStmt) astStmt()     {}
+func (n badStmt) astStmt()         {}
+func (n *decoStmt) astStmt()       {}
+func (n *defStmt) astStmt()        {}
+func (n *exprStmt) astStmt()       {}
+func (n *ifStmt) astStmt()         {}
+func (n *forStmt) astStmt()        {}
+func (n *whileStmt) astStmt()      {}
+func (n *returnStmt) astStmt()     {}
+func (n *breakStmt) astStmt()      {}
+func (n *continueStmt) astStmt()   {}
+func (n *assignStmt) astStmt()     {}
+func (n *augAssignStmt) astStmt()  {}
+func (n *raiseStmt) astStmt()      {}
+func (n *tryStmt) astStmt()        {}
+func (n *compStmt) astStmt()       {}
+func (n *declStmt) astStmt()       {}
+func (n *importStmt) astStmt()     {}
+func (n *fromImportStmt) astStmt() {}
 
 func (n *infixExpr) astExpr()     {}
 func (n *prefixExpr) astExpr()    {}
+func (n *compareExpr) astExpr()   {}
 func (n *callExpr) astExpr()      {}
 func (n *indexExpr) astExpr()     {}
+func (n *sliceExpr) astExpr()     {}
 func (n *arrowExpr) astExpr()     {}
+func (n *optChain) astExpr()      {}
+func (n *condExpr) astExpr()      {}
+func (n *walrusExpr) astExpr()    {}
+func (n *coalesceExpr) astExpr()  {}
 func (n *protoDictExpr) astExpr() {}
 func (n *ident) astExpr()         {}
 func (n *noneLit) astExpr()       {}
 func (n *boolLit) astExpr()       {}
 func (n *numLit) astExpr()        {}
 func (n *strLit) astExpr()        {}
+func (n *fStrLit) astExpr()       {}
+func (n *formatExpr) astExpr()    {}
 func (n *dictLit) astExpr()       {}
 func (n *listLit) astExpr()       {}
+func (n *tupleLit) astExpr()      {}
 func (n *lambdaLit) astExpr()     {}
-
-func (n badStmt) astNode()       {}
-func (n *decoStmt) astNode()     {}
-func (n *defStmt) astNode()      {}
-func (n *exprStmt) astNode()     {}
-func (n *ifStmt) astNode()       {}
-func (n *forStmt) astNode()      {}
-func (n *whileStmt) astNode()    {}
-func (n *returnStmt) astNode()   {}
-func (n *breakStmt) astNode()    {}
-func (n *continueStmt) astNode() {}
-func (n *assignStmt) astNode()   {}
-func (n *raiseStmt) astNode()    {}
-func (n *tryStmt) astNode()      {}
-func (n *declStmt) astNode()     {}
+func (n *compExpr) astExpr()      {}
+
+func (n badStmt) astNode()         {}
+func (n badStmt) pos() position    { return position{} }
+func (n *decoStmt) astNode()       {}
+func (n *defStmt) astNode()        {}
+func (n *exprStmt) astNode()       {}
+func (n *ifStmt) astNode()         {}
+func (n *forStmt) astNode()        {}
+func (n *whileStmt) astNode()      {}
+func (n *returnStmt) astNode()     {}
+func (n *breakStmt) astNode()      {}
+func (n *continueStmt) astNode()   {}
+func (n *assignStmt) astNode()     {}
+func (n *augAssignStmt) astNode()  {}
+func (n *raiseStmt) astNode()      {}
+func (n *tryStmt) astNode()        {}
+func (n *declStmt) astNode()       {}
+func (n *importStmt) astNode()     {}
+func (n *fromImportStmt) astNode() {}
 
 func (n *infixExpr) astNode()     {}
 func (n *prefixExpr) astNode()    {}
+func (n *compareExpr) astNode()   {}
 func (n *callExpr) astNode()      {}
 func (n *indexExpr) astNode()     {}
+func (n *sliceExpr) astNode()     {}
 func (n *arrowExpr) astNode()     {}
+func (n *optChain) astNode()      {}
+func (n *condExpr) astNode()      {}
+func (n *walrusExpr) astNode()    {}
+func (n *coalesceExpr) astNode()  {}
 func (n *protoDictExpr) astNode() {}
 func (n *ident) astNode()         {}
 func (n *noneLit) astNode()       {}
 func (n *boolLit) astNode()       {}
 func (n *numLit) astNode()        {}
 func (n *strLit) astNode()        {}
+func (n *fStrLit) astNode()       {}
+func (n *formatExpr) astNode()    {}
 func (n *dictLit) astNode()       {}
 func (n *listLit) astNode()       {}
+func (n *tupleLit) astNode()      {}
 func (n *lambdaLit) astNode()     {}
+func (n *compExpr) astNode()      {}
+func (n *compStmt) astNode()      {}
 
 /* == print ================================================================= */
 
@@ -237,6 +430,10 @@ func (p *printer) writeNode(node astNode) {
 		p.writeExprs(node.lefts)
 		p.write(" = ")
 		p.writeExprs(node.rights)
+	case *augAssignStmt:
+		p.writeNode(node.left)
+		p.write(" %s= ", node.op.literal)
+		p.writeNode(node.right)
 	case *returnStmt:
 		p.write("return ")
 		p.writeExprs(node.values)
@@ -283,10 +480,26 @@ func (p *printer) writeNode(node astNode) {
 		p.write("while ")
 		p.writeNode(node.cond)
 		p.writeBlock(node.loop)
+	case *forStmt:
+		p.write("for ")
+		p.writeVars(node.vars)
+		p.write(" in ")
+		p.writeNode(node.in)
+		p.writeBlock(node.loop)
+	case *breakStmt:
+		p.write("break")
+	case *continueStmt:
+		p.write("continue")
 	case *infixExpr:
 		p.writeNode(node.left)
 		p.write(" %s ", node.opToken.literal)
 		p.writeNode(node.right)
+	case *compareExpr:
+		p.writeNode(node.operands[0])
+		for i, op := range node.ops {
+			p.write(" %s ", op.literal)
+			p.writeNode(node.operands[i+1])
+		}
 	case *prefixExpr:
 		p.write("%s ", node.opToken.literal)
 		p.writeNode(node.right)
@@ -295,20 +508,71 @@ func (p *printer) writeNode(node astNode) {
 		p.write("{ TODO }")
 	case *indexExpr:
 		p.writeNode(node.left)
+		if node.optional {
+			p.write("?")
+		}
 		p.write("[")
 		p.writeNode(node.index)
 		p.write("]")
+	case *sliceExpr:
+		p.writeNode(node.left)
+		p.write("[")
+		if node.start != nil {
+			p.writeNode(node.start)
+		}
+		p.write(":")
+		if node.stop != nil {
+			p.writeNode(node.stop)
+		}
+		if node.step != nil {
+			p.write(":")
+			p.writeNode(node.step)
+		}
+		p.write("]")
 	case *callExpr:
 		p.writeNode(node.left)
 		p.writeArgs(node.args)
 	case *declStmt:
 		p.write("%s ", string(node.varType))
 		p.writeVars(node.vars)
+	case *importStmt:
+		p.write("import %s as %s", node.module, node.as)
+	case *fromImportStmt:
+		p.write("from %s import ", node.module)
+		for i, name := range node.names {
+			if i != 0 {
+				p.write(", ")
+			}
+			p.write("%s as %s", name, node.vars[i])
+		}
 	case *arrowExpr:
 		p.writeNode(node.left)
+		if node.optional {
+			p.write("?")
+		}
 		p.write("->[")
 		p.writeNode(node.index)
 		p.write("]")
+	case *optChain:
+		p.writeNode(node.expr)
+	case *condExpr:
+		p.write("(")
+		p.writeNode(node.then)
+		p.write(" if ")
+		p.writeNode(node.cond)
+		p.write(" else ")
+		p.writeNode(node.else_)
+		p.write(")")
+	case *walrusExpr:
+		p.write("(%s := ", node.target.name)
+		p.writeNode(node.value)
+		p.write(")")
+	case *coalesceExpr:
+		p.write("(")
+		p.writeNode(node.left)
+		p.write(" ?? ")
+		p.writeNode(node.right)
+		p.write(")")
 
 	case *noneLit:
 		p.write("None")
@@ -319,15 +583,44 @@ func (p *printer) writeNode(node astNode) {
 			p.write("False")
 		}
 	case *numLit:
-		p.write("%s", strconv.FormatFloat(node.value, 'g', -1, 64))
+		p.write("%v", node.value)
 	case *strLit:
 		p.write("\"%s\"", node.value)
+	case *fStrLit:
+		p.write("f\"")
+		for _, part := range node.parts {
+			if s, ok := part.(*strLit); ok {
+				p.write("%s", s.value)
+			} else {
+				p.writeNode(part)
+			}
+		}
+		p.write("\"")
+	case *formatExpr:
+		p.write("{")
+		p.writeNode(node.value)
+		if node.conv != 0 {
+			p.write("!%c", node.conv)
+		}
+		if node.spec != "" {
+			p.write(":%s", node.spec)
+		}
+		p.write("}")
 	case *dictLit:
 		p.write("{ TODO }")
+	case *compExpr:
+		p.writeComp(node)
 	case *listLit:
 		p.write("[")
 		p.writeExprs(node.elems)
 		p.write("]")
+	case *tupleLit:
+		p.write("(")
+		p.writeExprs(node.elems)
+		if len(node.elems) == 1 {
+			p.write(",")
+		}
+		p.write(")")
 	case *lambdaLit:
 		p.write("lambda ")
 		p.writeVars(node.params)
@@ -346,6 +639,50 @@ func (p *printer) writeTab()                  { p.write("%*s", p.tab, "") }
 func (p *printer) addTab()                    { p.tab += tabPrintSize }
 func (p *printer) subTab()                    { p.tab -= tabPrintSize }
 
+// writeComp writes a comprehension back from the loops of its function.
+func (p *printer) writeComp(comp *compExpr) {
+	brackets := map[compKind]string{compList: "[]", compDict: "{}", compGen: "()"}[comp.kind]
+	stmt := comp.body[0]
+	for inner := true; inner; {
+		switch node := stmt.(type) {
+		case *forStmt:
+			stmt = node.loop[0]
+		case *ifStmt:
+			stmt = node.then[0]
+		default:
+			inner = false
+		}
+	}
+	elem := stmt.(*compStmt)
+	p.write("%s", brackets[:1])
+	if elem.key != nil {
+		p.writeNode(elem.key)
+		p.write(": ")
+	}
+	p.writeNode(elem.value)
+	for stmt := comp.body[0]; ; {
+		switch node := stmt.(type) {
+		case *forStmt:
+			p.write(" for ")
+			p.writeVars(node.vars)
+			p.write(" in ")
+			if node == comp.body[0] {
+				p.writeNode(comp.in)
+			} else {
+				p.writeNode(node.in)
+			}
+			stmt = node.loop[0]
+		case *ifStmt:
+			p.write(" if ")
+			p.writeNode(node.cond)
+			stmt = node.then[0]
+		default:
+			p.write("%s", brackets[1:])
+			return
+		}
+	}
+}
+
 func (p *printer) writeBlock(block []astStmt) {
 	p.write(":\n")
 	p.addTab()
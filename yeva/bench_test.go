@@ -0,0 +1,53 @@
+package yeva
+
+import "testing"
+
+// benchmarks are scripts exercising calls, arithmetic, globals and
+// collections.
+var benchmarks = []struct{ name, source string }{
+	{"fib", `
+def fib(n):
+    if n < 2:
+        return n
+    return fib(n - 1) + fib(n - 2)
+x = fib(22)
+`},
+	{"loop", `
+total = 0
+i = 0
+while i < 200000:
+    total = total + i * 2
+    i = i + 1
+`},
+	{"float", `
+def f(n):
+    x = 0.0
+    while n > 0:
+        x = x + 0.5 * 1.5
+        n -= 1
+    return x
+y = f(100000)
+`},
+	{"list", `
+xs = []
+i = 0
+while i < 50000:
+    xs->push(i)
+    i += 1
+total = 0
+for v in xs:
+    total += v
+`},
+}
+
+func BenchmarkInterpret(b *testing.B) {
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for range b.N {
+				if err := New().Interpret([]byte(bm.source)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package yeva
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Bind makes a box of a Go struct or a pointer to one. The box reads and
+// writes exported fields and calls exported methods through '->'.
+//
+// Field names can be changed with a `yeva:"name"` tag, `yeva:"-"` hides
+// a field and `yeva:",readonly"` forbids scripts to set it. Structs
+// passed by value are copied, so only the copy is changed by scripts.
+func Bind(v any) (*Box, error) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.Pointer && rv.Type().Elem().Kind() == reflect.Struct:
+		if rv.IsNil() {
+			return nil, fmt.Errorf("bind: nil %s", rv.Type())
+		}
+	case rv.Kind() == reflect.Struct:
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		rv = ptr
+	default:
+		return nil, fmt.Errorf("bind: %T is not a struct", v)
+	}
+	return bindValue(rv), nil
+}
+
+type bindField struct {
+	index    []int
+	readOnly bool
+}
+
+type bindInfo struct {
+	fields map[string]bindField
+	names  []string // field names in declaration order
+	proto  *Prototype
+}
+
+var bindInfos sync.Map // reflect.Type -> *bindInfo
+
+// bindInfoOf gives the fields and methods of a pointer to struct type.
+func bindInfoOf(t reflect.Type) *bindInfo {
+	if info, ok := bindInfos.Load(t); ok {
+		return info.(*bindInfo)
+	}
+	info := &bindInfo{fields: make(map[string]bindField)}
+	for _, f := range reflect.VisibleFields(t.Elem()) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yeva"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := info.fields[name]; ok {
+			continue
+		}
+		info.fields[name] = bindField{f.Index, opts == "readonly"}
+		info.names = append(info.names, name)
+	}
+	methods := newDoc(t.NumMethod(), nil)
+	for i := range t.NumMethod() {
+		methods.Set(Str(t.Method(i).Name), bindMethod(t, t.Method(i)))
+	}
+	var proto Prototype = methods
+	info.proto = &proto
+	actual, _ := bindInfos.LoadOrStore(t, info)
+	return actual.(*bindInfo)
+}
+
+func bindMethod(t reflect.Type, m reflect.Method) *NativeFunc {
+	return &NativeFunc{
+		Name: m.Name,
+		Code: func(e *Evaluator, args []Value) []Value {
+			self, ok := Value(nil), len(args) > 0
+			if ok {
+				self = args[0]
+				b, isBox := self.(*Box)
+				ok = isBox && b.bound.IsValid() && b.bound.Type() == t
+			}
+			if !ok {
+				Raise(newError("TypeError", "%s() must be called on %s with '->'",
+					m.Name, t.Elem().Name()))
+			}
+			recv := self.(*Box).bound
+			return callGo(e, recv.Method(m.Index), m.Name, nil, args[1:])
+		},
+	}
+}
+
+func bindValue(ptr reflect.Value) *Box {
+	info := bindInfoOf(ptr.Type())
+	name := ptr.Type().Elem().Name()
+	field := func(key Value) (reflect.Value, bindField, bool) {
+		s, ok := key.(Str)
+		if !ok {
+			return reflect.Value{}, bindField{}, false
+		}
+		f, ok := info.fields[string(s)]
+		if !ok {
+			return reflect.Value{}, bindField{}, false
+		}
+		rv, err := ptr.Elem().FieldByIndexErr(f.index)
+		if err != nil {
+			return reflect.Value{}, bindField{}, false
+		}
+		return rv, f, true
+	}
+	get := func(key Value) Value {
+		rv, _, ok := field(key)
+		if !ok {
+			return None{}
+		}
+		if rv.Kind() == reflect.Struct {
+			rv = rv.Addr() // nested structs are shared, not copied
+		}
+		v, err := fromGo(rv)
+		if err != nil {
+			Raise(newError("TypeError", "%s.%v: %s", name, key, err))
+		}
+		return v
+	}
+	return &Box{
+		Getter: get,
+		Setter: func(key Value, val Value) {
+			rv, f, ok := field(key)
+			if !ok {
+				Raise(newError("AttributeError", "%s has no field '%v'", name, key))
+			}
+			if f.readOnly {
+				Raise(newError("AttributeError", "field '%v' of %s is read-only", key, name))
+			}
+			v, err := toGo(val, rv.Type())
+			if err != nil {
+				Raise(newError("TypeError", "%s.%v: %s", name, key, err))
+			}
+			rv.Set(v)
+		},
+		Proto: info.proto,
+		Iter: func() Iterator {
+			i := 0
+			return func() ([]Value, bool) {
+				if i >= len(info.names) {
+					return nil, false
+				}
+				key := Str(info.names[i])
+				i++
+				return []Value{key, get(key)}, true
+			}
+		},
+		bound: ptr,
+	}
+}
@@ -0,0 +1,95 @@
+package yeva
+
+import "testing"
+
+type point struct {
+	X, Y   int
+	Label  string `yeva:"label"`
+	ID     int    `yeva:"id,readonly"`
+	Secret string `yeva:"-"`
+}
+
+func (p *point) Move(dx, dy int) {
+	p.X += dx
+	p.Y += dy
+}
+
+func (p point) Sum() int { return p.X + p.Y }
+
+type line struct {
+	From, To point
+	Tags     []string
+}
+
+func TestBind(t *testing.T) {
+	p := &point{X: 1, Y: 2, Label: "a", ID: 7, Secret: "s"}
+	box, err := Bind(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := New()
+	e.Globals["p"] = box
+	err = e.Interpret([]byte(`
+p.X = 10
+p.label = "b"
+p->Move(1, 1)
+x = [p.X, p.Y, p.label, p.id, p.Secret, p->Sum()]
+keys = {}
+for k, v in p:
+    keys[k] = v
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != `[11, 3, "b", 7, None, 14]` {
+		t.Errorf("x = %s", got)
+	}
+	if got := show(global(t, e, "keys")); got != `{"X": 11, "Y": 3, "id": 7, "label": "b"}` {
+		t.Errorf("keys = %s", got)
+	}
+	if p.X != 11 || p.Label != "b" {
+		t.Errorf("p = %+v, want the changes of the script", p)
+	}
+
+	for _, source := range []string{`p.id = 1`, `p.X = "a"`, `p.Nope = 1`, `p->Move("a", 1)`} {
+		if err := e.Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%q) didn't fail", source)
+		}
+	}
+}
+
+func TestBindNested(t *testing.T) {
+	l := &line{To: point{X: 5}, Tags: []string{"a"}}
+	box, err := Bind(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := New()
+	e.Globals["l"] = box
+	if err := e.Interpret([]byte("l.To.Y = 3\nl.Tags = [\"b\", \"c\"]\nx = l.To->Sum()\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != "8" {
+		t.Errorf("x = %s, want 8", got)
+	}
+	if l.To.Y != 3 || len(l.Tags) != 2 || l.Tags[1] != "c" {
+		t.Errorf("l = %+v, want the changes of the script", l)
+	}
+}
+
+func TestBindCopy(t *testing.T) {
+	p := point{X: 1}
+	box, err := Bind(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box.Setter(Str("X"), Int(2))
+	if p.X != 1 || box.Getter(Str("X")) != Int(2) {
+		t.Errorf("a bound copy changed the struct")
+	}
+	for _, v := range []any{3, (*point)(nil), "s"} {
+		if _, err := Bind(v); err == nil {
+			t.Errorf("Bind(%#v) didn't fail", v)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package yeva
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type opCode byte
+
+const (
+	opConst opCode = iota
+	opNone
+	opTrue
+	opFalse
+	opPop
+	opDup
+	opReverse
+	opAdjustSpread
+	// variables
+	opGetLocal
+	opSetLocal
+	opGetOuter
+	opSetOuter
+	opGetGlobal
+	opSetGlobal
+	// values
+	opFunc
+	opList
+	opTuple
+	opDict
+	opProtoDict
+	opIndex
+	opSetIndex
+	opItem
+	opSetItem
+	opSlice
+	opSetSlice
+	opArrow
+	// operators
+	opNeg
+	opPos
+	opInvert
+	opNot
+	opEqual
+	opNotEqual
+	opAdd
+	opSub
+	opMul
+	opDiv
+	opMod
+	opPow
+	opFloorDiv
+	opLess
+	opLessEqual
+	opGreater
+	opGreaterEqual
+	opBitAnd
+	opBitOr
+	opBitXor
+	opShiftLeft
+	opShiftRight
+	opIn
+	opIs
+	opFormat
+	opConcat
+	opAppend
+	opAddPair
+	opGenerator
+	opYield
+	// control flow
+	opJump
+	opLoop
+	opJumpIfFalse
+	opJumpIfFalseOrPop
+	opJumpIfTrueOrPop
+	opJumpIfNone
+	opJumpIfNotNoneOrPop
+	opIter
+	opForIter
+	opCall
+	opCallSpread
+	opReturn
+	opReturnSpread
+	opSetupTry
+	opSetupFinally
+	opPopTry
+	opRaise
+	opReraise
+	// modules
+	opImport
+	opImportName
+)
+
+type opInfo struct {
+	name     string
+	operands []int // operand sizes in bytes
+}
+
+var opInfos = [...]opInfo{
+	opConst:              {"const", []int{2}},
+	opNone:               {"none", nil},
+	opTrue:               {"true", nil},
+	opFalse:              {"false", nil},
+	opPop:                {"pop", nil},
+	opDup:                {"dup", []int{1}},
+	opReverse:            {"reverse", []int{1}},
+	opAdjustSpread:       {"adjust spread", []int{1, 1}},
+	opGetLocal:           {"get local", []int{2}},
+	opSetLocal:           {"set local", []int{2}},
+	opGetOuter:           {"get outer", []int{1, 2}},
+	opSetOuter:           {"set outer", []int{1, 2}},
+	opGetGlobal:          {"get global", []int{2}},
+	opSetGlobal:          {"set global", []int{2}},
+	opFunc:               {"func", []int{2}},
+	opList:               {"list", []int{2}},
+	opTuple:              {"tuple", []int{2}},
+	opDict:               {"dict", []int{2}},
+	opProtoDict:          {"proto dict", []int{2}},
+	opIndex:              {"index", nil},
+	opSetIndex:           {"set index", nil},
+	opItem:               {"item", nil},
+	opSetItem:            {"set item", nil},
+	opSlice:              {"slice", nil},
+	opSetSlice:           {"set slice", nil},
+	opArrow:              {"arrow", nil},
+	opNeg:                {"neg", nil},
+	opPos:                {"pos", nil},
+	opInvert:             {"invert", nil},
+	opNot:                {"not", nil},
+	opEqual:              {"equal", nil},
+	opNotEqual:           {"not equal", nil},
+	opAdd:                {"add", nil},
+	opSub:                {"sub", nil},
+	opMul:                {"mul", nil},
+	opDiv:                {"div", nil},
+	opMod:                {"mod", nil},
+	opPow:                {"pow", nil},
+	opFloorDiv:           {"floor div", nil},
+	opLess:               {"less", nil},
+	opLessEqual:          {"less equal", nil},
+	opGreater:            {"greater", nil},
+	opGreaterEqual:       {"greater equal", nil},
+	opBitAnd:             {"bit and", nil},
+	opBitOr:              {"bit or", nil},
+	opBitXor:             {"bit xor", nil},
+	opShiftLeft:          {"shift left", nil},
+	opShiftRight:         {"shift right", nil},
+	opIn:                 {"in", nil},
+	opIs:                 {"is", nil},
+	opFormat:             {"format", []int{1, 2}},
+	opConcat:             {"concat", []int{2}},
+	opAppend:             {"append", []int{1}},
+	opAddPair:            {"add pair", []int{1}},
+	opGenerator:          {"generator", nil},
+	opYield:              {"yield", nil},
+	opJump:               {"jump", []int{2}},
+	opLoop:               {"loop", []int{2}},
+	opJumpIfFalse:        {"jump if false", []int{2}},
+	opJumpIfFalseOrPop:   {"jump if false or pop", []int{2}},
+	opJumpIfTrueOrPop:    {"jump if true or pop", []int{2}},
+	opJumpIfNone:         {"jump if none", []int{2}},
+	opJumpIfNotNoneOrPop: {"jump if not none or pop", []int{2}},
+	opIter:               {"iter", nil},
+	opForIter:            {"for iter", []int{1, 2}},
+	opCall:               {"call", []int{1, 1}},
+	opCallSpread:         {"call spread", []int{1, 1}},
+	opReturn:             {"return", []int{1}},
+	opReturnSpread:       {"return spread", []int{1}},
+	opSetupTry:           {"setup try", []int{2}},
+	opSetupFinally:       {"setup finally", []int{2}},
+	opPopTry:             {"pop try", nil},
+	opRaise:              {"raise", nil},
+	opReraise:            {"reraise", nil},
+	opImport:             {"import", []int{2}},
+	opImportName:         {"import name", []int{2}},
+}
+
+// binaryTokens maps number operators to the tokens understood
+// by numberOperation.
+var binaryTokens = [...]tokenType{
+	opAdd:          tokenPlus,
+	opSub:          tokenMinus,
+	opMul:          tokenStar,
+	opDiv:          tokenSlash,
+	opMod:          tokenPersent,
+	opPow:          tokenStarStar,
+	opFloorDiv:     tokenSlashSlash,
+	opLess:         tokenLess,
+	opLessEqual:    tokenLessEqual,
+	opGreater:      tokenGreater,
+	opGreaterEqual: tokenGreaterEqual,
+	opBitAnd:       tokenAmper,
+	opBitOr:        tokenPipe,
+	opBitXor:       tokenCaret,
+	opShiftLeft:    tokenLessLess,
+	opShiftRight:   tokenGreaterGreater,
+}
+
+// wantAll asks a call for all of its results.
+const wantAll = 0xff
+
+// posRun marks the source position of the code starting at start.
+type posRun struct {
+	start int
+	position
+}
+
+type chunk struct {
+	code      []byte
+	constants []Value
+	positions []posRun
+}
+
+type funcCode struct {
+	chunk
+	name    string
+	file    string
+	params  []varName
+	locals  int
+	globals *globalSlots // shared by the functions of a program
+}
+
+// globalSlots are the globals of a program by the slots the resolver
+// gave them. vals caches the values looked up by the owner, the cache
+// is valid while the epoch of the owner stays the same.
+type globalSlots struct {
+	names []Str
+	vals  []Value // nil where not looked up yet
+	owner *Evaluator
+	epoch int
+}
+
+func (v *funcCode) Type()          {}
+func (v *funcCode) String() string { return fmt.Sprintf("[code %s]", v.name) }
+
+func (c *chunk) readByte(ip int) int {
+	return int(c.code[ip])
+}
+
+func (c *chunk) readShort(ip int) int {
+	return int(c.code[ip])<<8 | int(c.code[ip+1])
+}
+
+func (c *chunk) write(pos position, bytes ...byte) {
+	if n := len(c.positions); n == 0 || c.positions[n-1].position != pos {
+		c.positions = append(c.positions, posRun{len(c.code), pos})
+	}
+	c.code = append(c.code, bytes...)
+}
+
+// position finds the source position of the instruction at ip.
+func (c *chunk) position(ip int) position {
+	i := sort.Search(len(c.positions), func(i int) bool {
+		return c.positions[i].start > ip
+	})
+	if i == 0 {
+		return position{}
+	}
+	return c.positions[i-1].position
+}
+
+/* == disassemble =========================================================== */
+
+func disassemble(code *funcCode) string {
+	data := &strings.Builder{}
+	disassembleFunc(data, code)
+	return strings.TrimRight(data.String(), "\n")
+}
+
+func disassembleFunc(data *strings.Builder, code *funcCode) {
+	fmt.Fprintln(data, cover(code.name, 12, "-"))
+	line := 0
+	for ip := 0; ip < len(code.code); {
+		op := opCode(code.code[ip])
+		info := opInfos[op]
+		if pos := code.position(ip); pos.line != line {
+			line = pos.line
+			fmt.Fprintf(data, "%04d %4d ", ip, line)
+		} else {
+			fmt.Fprintf(data, "%04d    | ", ip)
+		}
+		fmt.Fprintf(data, "%-20s", info.name)
+		ip++
+		for _, size := range info.operands {
+			var operand int
+			if size == 1 {
+				operand = code.readByte(ip)
+			} else {
+				operand = code.readShort(ip)
+			}
+			ip += size
+			fmt.Fprintf(data, " %d", operand)
+		}
+		switch op {
+		case opConst, opFunc, opImport, opImportName, opFormat:
+			fmt.Fprintf(data, " '%s'", shortString(fmt.Sprint(
+				code.constants[code.readShort(ip-2)]), 32, true))
+		case opGetGlobal, opSetGlobal:
+			fmt.Fprintf(data, " '%s'", code.globals.names[code.readShort(ip-2)])
+		case opJump, opJumpIfFalse, opJumpIfFalseOrPop, opJumpIfTrueOrPop,
+			opJumpIfNone, opJumpIfNotNoneOrPop, opForIter, opSetupTry, opSetupFinally:
+			fmt.Fprintf(data, " -> %04d", ip+code.readShort(ip-2))
+		case opLoop:
+			fmt.Fprintf(data, " -> %04d", ip-code.readShort(ip-2))
+		}
+		fmt.Fprintln(data)
+	}
+	for _, c := range code.constants {
+		if fc, ok := c.(*funcCode); ok {
+			disassembleFunc(data, fc)
+		}
+	}
+}
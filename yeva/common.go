@@ -8,8 +8,9 @@ import (
 const Version = "0.0.0"
 
 const (
-	debugPrintTokens = true
-	debugPrintAST    = true
+	debugPrintTokens = false
+	debugPrintAST    = false
+	debugPrintCode   = false
 )
 
 type varName = string
@@ -0,0 +1,707 @@
+package yeva
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+type compileError string
+
+type loopScope struct {
+	encl   *loopScope
+	start  int
+	breaks []int
+	hidden int
+	tries  int
+}
+
+type compiler struct {
+	code      *funcCode
+	constants map[Value]int
+	pos       position // position of the node being compiled
+	loop      *loopScope
+	hidden    int   // values kept on the stack between statements
+	tries     int   // active exception handlers
+	chain     []int // jumps to the end of the optional chain being compiled
+}
+
+func newCompiler(file, name string, params []varName, locals int) *compiler {
+	return &compiler{
+		code: &funcCode{
+			name:   name,
+			file:   file,
+			params: params,
+			locals: locals,
+		},
+		constants: make(map[Value]int),
+	}
+}
+
+func compile(file string, program []astStmt, globals []varName) (code *funcCode, err error) {
+	defer catch(func(ce compileError) { err = errors.New(string(ce)) })
+
+	c := newCompiler(file, "(main)", nil, 0)
+	if len(globals) > math.MaxUint16+1 {
+		c.error("too many globals")
+	}
+	c.code.globals = &globalSlots{
+		names: make([]Str, len(globals)),
+		vals:  make([]Value, len(globals)),
+	}
+	for i, name := range globals {
+		c.code.globals.names[i] = Str(name)
+	}
+	c.block(program)
+	c.emit(opReturn, 0)
+	return c.code, nil
+}
+
+func (c *compiler) function(def *defStmt) *funcCode {
+	fc := newCompiler(c.code.file, def.name, def.params, def.locals)
+	fc.code.globals = c.code.globals
+	fc.pos = def.pos()
+	fc.block(def.body)
+	fc.emit(opNone)
+	fc.emit(opReturn, 1)
+	return fc.code
+}
+
+// comprehension compiles the function of a comprehension. It builds the
+// list or the doc below the iterators of its loops.
+func (c *compiler) comprehension(comp *compExpr) *funcCode {
+	fc := newCompiler(c.code.file, comp.name, comp.params, comp.locals)
+	fc.code.globals = c.code.globals
+	fc.pos = comp.pos()
+	switch comp.kind {
+	case compList:
+		fc.emit(opList, 0)
+	case compDict:
+		fc.emit(opDict, 0)
+	case compGen:
+		fc.emit(opNone) // returned once exhausted
+	}
+	fc.hidden++
+	fc.block(comp.body)
+	fc.emit(opReturn, 1)
+	return fc.code
+}
+
+func (c *compiler) error(format string, a ...any) {
+	panic(compileError(c.pos.String() + ": " + fmt.Sprintf(format, a...)))
+}
+
+// at makes node the current position until the returned func is called.
+func (c *compiler) at(node astNode) func() {
+	prev := c.pos
+	c.pos = node.pos()
+	return func() { c.pos = prev }
+}
+
+/* == emit ================================================================== */
+
+func (c *compiler) emit(op opCode, operands ...int) int {
+	pos := len(c.code.code)
+	c.code.write(c.pos, byte(op))
+	for i, size := range opInfos[op].operands {
+		operand := operands[i]
+		if size == 1 {
+			if operand > math.MaxUint8 {
+				c.error("too many values in one expression")
+			}
+			c.code.write(c.pos, byte(operand))
+		} else {
+			if operand > math.MaxUint16 {
+				c.error("too much code in function '%s'", c.code.name)
+			}
+			c.code.write(c.pos, byte(operand>>8), byte(operand))
+		}
+	}
+	return pos
+}
+
+// emitJump emits a forward jump and returns the position to patch.
+func (c *compiler) emitJump(op opCode, operands ...int) int {
+	c.emit(op, append(operands, 0)...)
+	return len(c.code.code) - 2
+}
+
+func (c *compiler) patchJump(at int) {
+	c.patchJumpTo(at, len(c.code.code))
+}
+
+func (c *compiler) patchJumpTo(at, target int) {
+	offset := target - (at + 2)
+	if offset > math.MaxUint16 {
+		c.error("too much code to jump over")
+	}
+	c.code.code[at] = byte(offset >> 8)
+	c.code.code[at+1] = byte(offset)
+}
+
+func (c *compiler) emitLoop(start int) {
+	c.emit(opLoop, len(c.code.code)+3-start)
+}
+
+func (c *compiler) constant(val Value) int {
+	if i, ok := c.constants[val]; ok {
+		return i
+	}
+	i := len(c.code.constants)
+	if i > math.MaxUint16 {
+		c.error("too many constants in function '%s'", c.code.name)
+	}
+	c.code.constants = append(c.code.constants, val)
+	c.constants[val] = i
+	return i
+}
+
+func (c *compiler) getVariable(ref varRef) {
+	switch {
+	case ref.isGlobal():
+		c.emit(opGetGlobal, ref.slot)
+	case ref.depth == 0:
+		c.emit(opGetLocal, ref.slot)
+	default:
+		c.emit(opGetOuter, ref.depth, ref.slot)
+	}
+}
+
+// setVariable stores the value on top of the stack into the variable.
+func (c *compiler) setVariable(ref varRef) {
+	switch {
+	case ref.isGlobal():
+		c.emit(opSetGlobal, ref.slot)
+	case ref.depth == 0:
+		c.emit(opSetLocal, ref.slot)
+	default:
+		c.emit(opSetOuter, ref.depth, ref.slot)
+	}
+}
+
+/* == statements ============================================================ */
+
+func (c *compiler) block(stmts []astStmt) {
+	for _, stmt := range stmts {
+		c.stmt(stmt)
+	}
+}
+
+func (c *compiler) stmt(node astStmt) {
+	defer c.at(node)()
+
+	switch node := node.(type) {
+	case *exprStmt:
+		if call, ok := node.expr.(*callExpr); ok {
+			c.callExpr(call, 0)
+		} else {
+			c.expr(node.expr)
+			c.emit(opPop)
+		}
+	case *assignStmt:
+		c.assignStmt(node)
+	case *augAssignStmt:
+		c.augAssignStmt(node)
+	case *declStmt:
+		// resolved at compile time
+	case *defStmt:
+		c.emit(opFunc, c.constant(c.function(node)))
+		c.setVariable(node.ref)
+	case *decoStmt:
+		c.expr(node.deco)
+		c.emit(opFunc, c.constant(c.function(node.def)))
+		c.emit(opCall, 1, 1)
+		c.setVariable(node.def.ref)
+	case *ifStmt:
+		c.expr(node.cond)
+		toElse := c.emitJump(opJumpIfFalse)
+		c.block(node.then)
+		toEnd := c.emitJump(opJump)
+		c.patchJump(toElse)
+		c.block(node.else_)
+		c.patchJump(toEnd)
+	case *whileStmt:
+		c.whileStmt(node)
+	case *forStmt:
+		c.forStmt(node)
+	case *breakStmt:
+		c.unwindLoop()
+		c.loop.breaks = append(c.loop.breaks, c.emitJump(opJump))
+	case *continueStmt:
+		c.unwindLoop()
+		c.emitLoop(c.loop.start)
+	case *importStmt:
+		c.emit(opImport, c.constant(Str(node.module)))
+		c.setVariable(node.ref)
+	case *fromImportStmt:
+		c.emit(opImport, c.constant(Str(node.module)))
+		for i, name := range node.names {
+			c.emit(opImportName, c.constant(Str(name)))
+			c.setVariable(node.refs[i])
+		}
+		c.emit(opPop)
+	case *returnStmt:
+		n, spread := c.exprs(node.values)
+		if spread {
+			c.emit(opReturnSpread, n)
+		} else {
+			c.emit(opReturn, n)
+		}
+	case *raiseStmt:
+		c.expr(node.exc)
+		c.emit(opRaise)
+	case *tryStmt:
+		c.tryStmt(node)
+	case *compStmt:
+		switch node.kind {
+		case compList:
+			c.expr(node.value)
+			c.emit(opAppend, c.hidden-1)
+		case compDict:
+			c.expr(node.key)
+			c.expr(node.value)
+			c.emit(opAddPair, c.hidden-1)
+		case compGen:
+			c.expr(node.value)
+			c.emit(opYield)
+		}
+	default:
+		panic("compile: unknown node type")
+	}
+}
+
+func (c *compiler) assignStmt(node *assignStmt) {
+	n, spread := c.exprs(node.rights)
+	want := len(node.lefts)
+	if spread {
+		c.emit(opAdjustSpread, n, want)
+	} else {
+		for ; n < want; n++ {
+			c.emit(opNone)
+		}
+		for ; n > want; n-- {
+			c.emit(opPop)
+		}
+	}
+	if want > 1 {
+		c.emit(opReverse, want)
+	}
+	for _, left := range node.lefts {
+		c.assign(left)
+	}
+}
+
+// augAssignStmt evaluates the container and the key of the target once,
+// they stay on the stack for the store.
+func (c *compiler) augAssignStmt(node *augAssignStmt) {
+	switch left := node.left.(type) {
+	case *ident:
+		c.getVariable(left.ref)
+		c.expr(node.right)
+		c.operator(node.op.tokenType)
+		c.setVariable(left.ref)
+	case *indexExpr:
+		c.expr(left.left)
+		c.expr(left.index)
+		c.emit(opDup, 2)
+		if left.item {
+			c.emit(opItem)
+		} else {
+			c.emit(opIndex)
+		}
+		c.expr(node.right)
+		c.operator(node.op.tokenType)
+		c.emit(opReverse, 3)
+		c.emit(opReverse, 2)
+		if left.item {
+			c.emit(opSetItem)
+		} else {
+			c.emit(opSetIndex)
+		}
+	case *sliceExpr:
+		c.expr(left.left)
+		c.bounds(left)
+		c.emit(opDup, 4)
+		c.emit(opSlice)
+		c.expr(node.right)
+		c.operator(node.op.tokenType)
+		c.emit(opReverse, 5)
+		c.emit(opReverse, 4)
+		c.emit(opSetSlice)
+	default:
+		panic("compile aug assign: unknown target")
+	}
+}
+
+// assign stores the value on top of the stack into the target.
+func (c *compiler) assign(to astExpr) {
+	switch to := to.(type) {
+	case *ident:
+		c.setVariable(to.ref)
+	case *indexExpr:
+		c.expr(to.left)
+		c.expr(to.index)
+		if to.item {
+			c.emit(opSetItem)
+		} else {
+			c.emit(opSetIndex)
+		}
+	case *sliceExpr:
+		c.expr(to.left)
+		c.bounds(to)
+		c.emit(opSetSlice)
+	default:
+		panic("compile assign: unknown target")
+	}
+}
+
+// bounds pushes the bounds of a slice, None for those left out.
+func (c *compiler) bounds(node *sliceExpr) {
+	for _, bound := range []astExpr{node.start, node.stop, node.step} {
+		if bound != nil {
+			c.expr(bound)
+		} else {
+			c.emit(opNone)
+		}
+	}
+}
+
+func (c *compiler) whileStmt(node *whileStmt) {
+	start := len(c.code.code)
+	c.expr(node.cond)
+	exit := c.emitJump(opJumpIfFalse)
+	c.loopBody(start, node.loop)
+	c.patchJump(exit)
+	c.patchBreaks()
+}
+
+func (c *compiler) forStmt(node *forStmt) {
+	c.expr(node.in)
+	c.emit(opIter)
+	c.hidden++
+	start := len(c.code.code)
+	exit := c.emitJump(opForIter, len(node.vars))
+	for i := range node.vars {
+		c.setVariable(node.refs[i])
+	}
+	c.loopBody(start, node.loop)
+	c.patchJump(exit)
+	c.patchBreaks()
+	c.emit(opPop)
+	c.hidden--
+}
+
+func (c *compiler) loopBody(start int, body []astStmt) {
+	c.loop = &loopScope{
+		encl:   c.loop,
+		start:  start,
+		hidden: c.hidden,
+		tries:  c.tries,
+	}
+	c.block(body)
+	c.emitLoop(start)
+}
+
+func (c *compiler) patchBreaks() {
+	for _, at := range c.loop.breaks {
+		c.patchJump(at)
+	}
+	c.loop = c.loop.encl
+}
+
+// unwindLoop drops values and handlers pushed since the loop started.
+func (c *compiler) unwindLoop() {
+	for range c.hidden - c.loop.hidden {
+		c.emit(opPop)
+	}
+	for range c.tries - c.loop.tries {
+		c.emit(opPopTry)
+	}
+}
+
+func (c *compiler) tryStmt(node *tryStmt) {
+	setup := opSetupTry
+	if node.except == nil {
+		setup = opSetupFinally
+	}
+	toHandler := c.emitJump(setup)
+	c.tries++
+	c.block(node.try)
+	c.tries--
+	c.emit(opPopTry)
+	toFinally := c.emitJump(opJump)
+
+	c.patchJump(toHandler) // exception is on the stack
+	if node.except != nil {
+		c.setVariable(node.asRef)
+		if node.finally == nil {
+			c.block(node.except)
+		} else {
+			toReraise := c.emitJump(opSetupFinally)
+			c.tries++
+			c.block(node.except)
+			c.tries--
+			c.emit(opPopTry)
+			toEnd := c.emitJump(opJump)
+			c.patchJump(toReraise)
+			c.finallyRaise(node.finally)
+			c.patchJump(toEnd)
+		}
+	} else {
+		c.finallyRaise(node.finally)
+	}
+
+	c.patchJump(toFinally)
+	c.block(node.finally)
+}
+
+// finallyRaise runs the finally block and raises the pending exception
+// again, with the traceback of where it was first raised.
+func (c *compiler) finallyRaise(finally []astStmt) {
+	c.hidden++
+	c.block(finally)
+	c.hidden--
+	c.emit(opReraise)
+}
+
+/* == expressions =========================================================== */
+
+func (c *compiler) expr(node astExpr) {
+	defer c.at(node)()
+
+	switch node := node.(type) {
+	case *noneLit:
+		c.emit(opNone)
+	case *boolLit:
+		if node.value {
+			c.emit(opTrue)
+		} else {
+			c.emit(opFalse)
+		}
+	case *numLit:
+		c.emit(opConst, c.constant(node.value))
+	case *strLit:
+		c.emit(opConst, c.constant(Str(node.value)))
+	case *fStrLit:
+		for _, part := range node.parts {
+			c.expr(part)
+		}
+		if len(node.parts) != 1 {
+			c.emit(opConcat, len(node.parts))
+		}
+	case *formatExpr:
+		c.expr(node.value)
+		c.emit(opFormat, int(node.conv), c.constant(Str(node.spec)))
+	case *ident:
+		c.getVariable(node.ref)
+	case *lambdaLit:
+		c.emit(opFunc, c.constant(c.function(node.defStmt)))
+	case *compExpr:
+		c.emit(opFunc, c.constant(c.comprehension(node)))
+		c.expr(node.in)
+		if node.kind == compGen {
+			c.emit(opGenerator)
+		} else {
+			c.emit(opCall, 1, 1)
+		}
+	case *listLit:
+		for _, elem := range node.elems {
+			c.expr(elem)
+		}
+		c.emit(opList, len(node.elems))
+	case *tupleLit:
+		for _, elem := range node.elems {
+			c.expr(elem)
+		}
+		c.emit(opTuple, len(node.elems))
+	case *dictLit:
+		c.pairs(node)
+		c.emit(opDict, len(node.keys))
+	case *protoDictExpr:
+		c.expr(node.proto)
+		c.pairs(node.dict)
+		c.emit(opProtoDict, len(node.dict.keys))
+	case *indexExpr:
+		c.expr(node.left)
+		if node.optional {
+			c.chain = append(c.chain, c.emitJump(opJumpIfNone))
+		}
+		c.expr(node.index)
+		if node.item {
+			c.emit(opItem)
+		} else {
+			c.emit(opIndex)
+		}
+	case *sliceExpr:
+		c.expr(node.left)
+		c.bounds(node)
+		c.emit(opSlice)
+	case *arrowExpr:
+		c.expr(node.left)
+		if node.optional {
+			c.chain = append(c.chain, c.emitJump(opJumpIfNone))
+		}
+		c.expr(node.index)
+		c.emit(opArrow)
+	case *optChain:
+		outer := c.chain
+		c.chain = nil
+		c.expr(node.expr)
+		for _, at := range c.chain {
+			c.patchJump(at)
+		}
+		c.chain = outer
+	case *condExpr:
+		c.expr(node.cond)
+		toElse := c.emitJump(opJumpIfFalse)
+		c.expr(node.then)
+		end := c.emitJump(opJump)
+		c.patchJump(toElse)
+		c.expr(node.else_)
+		c.patchJump(end)
+	case *walrusExpr:
+		c.expr(node.value)
+		c.emit(opDup, 1)
+		c.setVariable(node.target.ref)
+	case *coalesceExpr:
+		c.expr(node.left)
+		end := c.emitJump(opJumpIfNotNoneOrPop)
+		c.expr(node.right)
+		c.patchJump(end)
+	case *callExpr:
+		c.callExpr(node, 1)
+	case *prefixExpr:
+		c.expr(node.right)
+		switch node.opToken.tokenType {
+		case tokenMinus:
+			c.emit(opNeg)
+		case tokenPlus:
+			c.emit(opPos)
+		case tokenTilde:
+			c.emit(opInvert)
+		case tokenNot:
+			c.emit(opNot)
+		default:
+			panic("compile prefix expr: unknown prefix")
+		}
+	case *infixExpr:
+		c.infixExpr(node)
+	case *compareExpr:
+		c.compareExpr(node)
+	default:
+		panic("compile: unknown node type")
+	}
+}
+
+// exprs compiles a list of expressions whose last call may spread
+// into several values.
+func (c *compiler) exprs(exprs []astExpr) (n int, spread bool) {
+	for i, expr := range exprs {
+		if call, ok := expr.(*callExpr); ok && i == len(exprs)-1 {
+			c.callExpr(call, wantAll)
+			return i, true
+		}
+		c.expr(expr)
+	}
+	return len(exprs), false
+}
+
+func (c *compiler) callExpr(node *callExpr, want int) {
+	defer c.at(node)()
+
+	c.expr(node.left)
+	n, spread := c.exprs(node.args)
+	if spread {
+		c.emit(opCallSpread, n, want)
+	} else {
+		c.emit(opCall, n, want)
+	}
+}
+
+func (c *compiler) pairs(dict *dictLit) {
+	for i, key := range dict.keys {
+		c.expr(key)
+		c.expr(dict.vals[i])
+	}
+}
+
+var infixOps = map[tokenType]opCode{
+	tokenEqualEqual:   opEqual,
+	tokenBangEqual:    opNotEqual,
+	tokenPlus:         opAdd,
+	tokenMinus:        opSub,
+	tokenStar:         opMul,
+	tokenSlash:        opDiv,
+	tokenPersent:      opMod,
+	tokenStarStar:     opPow,
+	tokenSlashSlash:   opFloorDiv,
+	tokenLess:         opLess,
+	tokenLessEqual:    opLessEqual,
+	tokenGreater:      opGreater,
+	tokenGreaterEqual: opGreaterEqual,
+	tokenIn:           opIn,
+	tokenNotIn:        opIn,
+	tokenIs:           opIs,
+	tokenIsNot:        opIs,
+
+	tokenAmper:          opBitAnd,
+	tokenPipe:           opBitOr,
+	tokenCaret:          opBitXor,
+	tokenLessLess:       opShiftLeft,
+	tokenGreaterGreater: opShiftRight,
+}
+
+func (c *compiler) infixExpr(node *infixExpr) {
+	c.expr(node.left)
+	switch node.opToken.tokenType {
+	case tokenAnd:
+		end := c.emitJump(opJumpIfFalseOrPop)
+		c.expr(node.right)
+		c.patchJump(end)
+		return
+	case tokenOr:
+		end := c.emitJump(opJumpIfTrueOrPop)
+		c.expr(node.right)
+		c.patchJump(end)
+		return
+	}
+	c.expr(node.right)
+	c.operator(node.opToken.tokenType)
+}
+
+func (c *compiler) operator(t tokenType) {
+	op, ok := infixOps[t]
+	if !ok {
+		panic("compile infix expr: unknown operation")
+	}
+	c.emit(op)
+	if t == tokenNotIn || t == tokenIsNot {
+		c.emit(opNot)
+	}
+}
+
+// compareExpr compiles 'a < b < c' like 'a < b and b < c' keeping b on
+// the stack for the next comparison.
+func (c *compiler) compareExpr(node *compareExpr) {
+	c.expr(node.operands[0])
+	var ends []int
+	for i, op := range node.ops {
+		c.expr(node.operands[i+1])
+		if i == len(node.ops)-1 {
+			c.operator(op.tokenType)
+			break
+		}
+		c.emit(opDup, 1)
+		c.emit(opReverse, 3)
+		c.emit(opReverse, 2)
+		c.operator(op.tokenType)
+		ends = append(ends, c.emitJump(opJumpIfFalseOrPop))
+	}
+	end := c.emitJump(opJump)
+	for _, at := range ends {
+		c.patchJump(at)
+	}
+	c.emit(opReverse, 2) // drop the operand kept for the next comparison
+	c.emit(opPop)
+	c.patchJump(end)
+}
@@ -0,0 +1,218 @@
+package yeva
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOperators(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"not", `x = [not True, not None, not 0]`, "[False, True, False]"},
+		{"unary plus", `x = +5`, "5"},
+		{"power right associative", `x = 2 ** 3 ** 2`, "512"},
+		{"in", `x = [1 in [1, 2], "a" in {a: 1}, "ell" in "hello", 3 not in (1, 2)]`, "[True, True, True, True]"},
+		{"is", `
+a = [1]
+x = [a is a, a is [1], None is None, a is not None]
+`, "[True, False, True, True]"},
+		{"chained comparisons", `x = [0 <= 5 < 10, 0 <= 15 < 10, 1 < 2 > 0]`, "[True, False, True]"},
+		{"chain evaluates once", `
+n = 0
+def f():
+    global n
+    n = n + 1
+    return 5
+ok = 0 < f() < 10
+x = n
+`, "1"},
+		{"and or", `x = [None or 2, 1 and 2, False and f()]`, "[2, 2, False]"},
+	})
+
+	if err := New().Interpret([]byte(`x = +"a"`)); err == nil {
+		t.Error("unary plus of a string didn't fail")
+	}
+}
+
+func TestAugmentedAssignment(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"operators", `
+x = []
+n = 10
+n += 5
+x->push(n)
+n -= 3
+x->push(n)
+n *= 2
+x->push(n)
+n //= 5
+x->push(n)
+n %= 3
+x->push(n)
+n **= 3
+x->push(n)
+n <<= 2
+x->push(n)
+n |= 1
+x->push(n)
+n &= 5
+x->push(n)
+n ^= 1
+x->push(n)
+n >>= 1
+x->push(n)
+n /= 4
+x->push(n)
+`, "[15, 12, 24, 4, 1, 1, 4, 5, 5, 4, 2, 0.5]"},
+		{"index evaluated once", `
+calls = 0
+d = {k: 1}
+def key():
+    global calls
+    calls += 1
+    return "k"
+d[key()] += 5
+x = [d.k, calls]
+`, "[6, 1]"},
+		{"nonlocal", `
+def f():
+    n = 1
+    def g():
+        nonlocal n
+        n += 1
+    g()
+    return n
+x = f()
+`, "2"},
+		{"strings", `
+x = "a"
+x += "b"
+`, `"ab"`},
+	})
+
+	for _, source := range []string{"x += 1\n", "x = 1\nx += \"a\"\n"} {
+		if err := New().Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%q) didn't fail", source)
+		}
+	}
+}
+
+func TestConditionalExpressions(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"conditional", `x = ["a" if 1 > 2 else "b", "c" if True else "d"]`, `["b", "c"]`},
+		{"walrus", `
+xs = [1, 2, 3]
+if (n := xs->length()) > 2:
+    x = n
+`, "3"},
+		{"optional chaining", `
+user = {address: None}
+x = [user?.address?.city, {a: {b: 1}}?.a?.b]
+`, "[None, 1]"},
+		{"optional arrow", `
+d = None
+x = d?->keys()
+`, "None"},
+		{"coalesce", `x = [None ?? 1, 2 ?? 3, False ?? 4]`, "[1, 2, False]"},
+		{"coalesce chains", `
+user = {}
+x = user?.name ?? "anon"
+`, `"anon"`},
+	})
+}
+
+func TestComprehensions(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"list", `x = [v * v for v in [1, 2, 3, 4] if v % 2 == 0]`, "[4, 16]"},
+		{"nested", `x = [a + b for a in ["a", "b"] for b in ["1", "2"]]`, `["a1", "a2", "b1", "b2"]`},
+		{"dict", `x = {[v]: v * 2 for v in [1, 2]}`, "{1: 2, 2: 4}"},
+		{"dict bare key", `x = {k: 1 for k in ["a", "b"]}`, `{"a": 1, "b": 1}`},
+		{"dict from items", `x = {k: v * 10 for k, v in {a: 1, b: 2}->items()}`, `{"a": 10, "b": 20}`},
+		{"unpacking", `x = [a + b for a, b in [(1, 2), [3, 4]]]`, "[3, 7]"},
+		{"generator", `
+log = []
+def f(v):
+    log->push(v)
+    return v
+g = (f(v) for v in [1, 2, 3])
+before = log->length()
+x = [before, [v for v in g], log->length()]
+`, "[0, [1, 2, 3], 3]"},
+		{"generator argument", `x = [1, 2, 3]->map(lambda v: v)->concat([v for v in (w * 2 for w in [5])])`, "[1, 2, 3, 10]"},
+		{"own scope", `
+v = "outer"
+ys = [v for v in [1, 2]]
+x = v
+`, `"outer"`},
+		{"closure over outer", `
+def f(k):
+    return [v * k for v in [1, 2]]
+x = f(3)
+`, "[3, 6]"},
+		{"walrus binds outside", `
+n = 0
+l = [(n := n + v) for v in [1, 2, 3]]
+x = [l, n]
+`, "[[1, 3, 6], 6]"},
+		{"walrus in function", `
+def f(xs):
+    n = 0
+    l = [(n := n + v) for v in xs if (last := v) > 0]
+    return [l, n, last]
+x = f([1, -5, 2])
+`, "[[1, 3], 3, 2]"},
+		{"walrus in nested comprehension", `
+def f():
+    [[(m := a * b) for b in [2, 3]] for a in [1, 2]]
+    return m
+x = f()
+`, "6"},
+		{"walrus in generator", `
+def f():
+    g = ((last := v) for v in [1, 2])
+    l = [v for v in g]
+    return last
+x = f()
+`, "2"},
+		{"walrus of global", `
+def f():
+    global total
+    total = 0
+    [(total := total + v) for v in [1, 2]]
+f()
+x = total
+`, "3"},
+	})
+}
+
+func TestComprehensionWalrusErrors(t *testing.T) {
+	for _, source := range []string{
+		"x = [(v := 1) for v in [1, 2]]\n",
+		"def f():\n    return [[(a := b) for b in [1]] for a in [2]]\n",
+	} {
+		err := New().Interpret([]byte(source))
+		if err == nil || !strings.Contains(err.Error(), "can't rebind comprehension variable") {
+			t.Errorf("Interpret(%q) = %v, want a compile error", source, err)
+		}
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	for _, tt := range []struct{ source, name string }{
+		{"for a, b in [[1, 2, 3]]:\n    x = a\n", "ValueError"},
+		{"for a, b in [(1,)]:\n    x = a\n", "ValueError"},
+		{"for a, b in [1]:\n    x = a\n", "TypeError"},
+		{"x = [a for a, b in [1]]\n", "TypeError"},
+		{"x = {k: v for k, v, w in {a: 1}->items()}\n", "ValueError"},
+	} {
+		err := New().Interpret([]byte(tt.source))
+		var exc *RuntimeException
+		if !errors.As(err, &exc) {
+			t.Errorf("Interpret(%q) = %v, want %s", tt.source, err, tt.name)
+			continue
+		}
+		if v, ok := exc.Value.(*Error); !ok || v.Name != tt.name {
+			t.Errorf("Interpret(%q) raised %v, want %s", tt.source, exc.Value, tt.name)
+		}
+	}
+}
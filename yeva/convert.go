@@ -0,0 +1,565 @@
+package yeva
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	valueType     = reflect.TypeFor[Value]()
+	errorType     = reflect.TypeFor[error]()
+	evaluatorType = reflect.TypeFor[*Evaluator]()
+	callableType  = reflect.TypeFor[Callable]()
+	bigIntType    = reflect.TypeFor[*big.Int]()
+)
+
+func typeName(v Value) string {
+	switch v := v.(type) {
+	case None:
+		return "None"
+	case Bool:
+		return "Bool"
+	case Num:
+		return "Num"
+	case Int, BigInt:
+		return "Int"
+	case Decimal:
+		return "Decimal"
+	case Str:
+		return "Str"
+	case *Doc:
+		return "Doc"
+	case *Array:
+		return "Array"
+	case *Tuple:
+		return "Tuple"
+	case *Func, *NativeFunc, *Method:
+		return "Func"
+	case *Box:
+		if v.bound.IsValid() {
+			return v.bound.Type().Elem().Name()
+		}
+		return "Box"
+	case *Error:
+		return "Error"
+	case *Generator:
+		return "Generator"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// converter tracks the docs, arrays and Go values being converted to
+// catch cycles.
+type converter struct {
+	values map[Value]bool
+	refs   map[goRef]bool
+}
+
+// goRef identifies a Go map, slice or pointer by its data.
+type goRef struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// FromGo converts a Go value to a script value. Integers become Int,
+// floats Num, slices and arrays become lists, maps become docs, structs
+// become boxes made by Bind and functions are wrapped by WrapFunc.
+func FromGo(v any) (Value, error) {
+	return fromGo(reflect.ValueOf(v))
+}
+
+// ToGo converts a script value to Go: float64, int64, *big.Int for
+// integers too big for int64, string, bool, nil, []any for lists,
+// map[string]any for docs with string keys and map[any]any for other
+// docs. Bound boxes give their Go pointer and other values are returned
+// as is.
+func ToGo(v Value) (any, error) {
+	rv, err := toGo(v, reflect.TypeFor[any]())
+	if err != nil {
+		return nil, err
+	}
+	return rv.Interface(), nil
+}
+
+// As converts a script value to a Go value of type T, docs are
+// converted to maps or structs and lists to slices.
+func As[T any](v Value) (T, error) {
+	var out T
+	rv, err := toGo(v, reflect.TypeFor[T]())
+	if err != nil {
+		return out, err
+	}
+	reflect.ValueOf(&out).Elem().Set(rv)
+	return out, nil
+}
+
+// goTypeName names Go types in messages, value types by their script
+// names.
+func goTypeName(t reflect.Type) string {
+	if t.Implements(valueType) {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.PkgPath() == valueType.PkgPath() {
+			return t.Name()
+		}
+	}
+	return t.String()
+}
+
+// toGo converts a script value to a Go value of type t.
+func toGo(v Value, t reflect.Type) (reflect.Value, error) {
+	return (&converter{}).toGo(v, t)
+}
+
+// fromGo converts a Go value to a script value, structs become
+// bound boxes.
+func fromGo(rv reflect.Value) (Value, error) {
+	return (&converter{}).fromGo(rv)
+}
+
+func (c *converter) enter(v Value) error {
+	if c.values[v] {
+		return fmt.Errorf("cyclic %s can't be converted", typeName(v))
+	}
+	if c.values == nil {
+		c.values = make(map[Value]bool)
+	}
+	c.values[v] = true
+	return nil
+}
+
+func (c *converter) enterGo(rv reflect.Value) (goRef, error) {
+	ref := goRef{ptr: rv.Pointer(), typ: rv.Type()}
+	if rv.Kind() == reflect.Slice {
+		ref.len = rv.Len()
+	}
+	if c.refs[ref] {
+		return ref, fmt.Errorf("cyclic %s can't be converted", rv.Type())
+	}
+	if c.refs == nil {
+		c.refs = make(map[goRef]bool)
+	}
+	c.refs[ref] = true
+	return ref, nil
+}
+
+func (c *converter) toGo(v Value, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return c.toGoAny(v)
+	}
+	if reflect.TypeOf(v).AssignableTo(t) {
+		return reflect.ValueOf(v), nil
+	}
+	if t == bigIntType && isInt(v) {
+		return reflect.ValueOf(new(big.Int).Set(bigOf(v))), nil
+	}
+	if t == callableType {
+		if m := protoMethod(v, "__call__"); m != nil {
+			return reflect.ValueOf(m), nil // values with '__call__'
+		}
+	}
+	if b, ok := v.(*Box); ok && b.bound.IsValid() {
+		switch {
+		case b.bound.Type().AssignableTo(t):
+			return b.bound, nil
+		case b.bound.Type().Elem().AssignableTo(t):
+			return b.bound.Elem(), nil
+		}
+	}
+	rv := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, ok := v.(Bool); ok {
+			rv.SetBool(bool(b))
+			return rv, nil
+		}
+	case reflect.String:
+		if s, ok := v.(Str); ok {
+			rv.SetString(string(s))
+			return rv, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if isNumber(v) {
+			f, _ := floatOf(v)
+			if math.IsInf(f, 0) && isInt(v) {
+				return rv, fmt.Errorf("%v doesn't fit %s", v, goTypeName(t))
+			}
+			rv.SetFloat(f)
+			return rv, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if isNumber(v) {
+			n, ok := normNum(v).(Int)
+			if !ok || rv.OverflowInt(int64(n)) {
+				return rv, fmt.Errorf("%v doesn't fit %s", v, goTypeName(t))
+			}
+			rv.SetInt(int64(n))
+			return rv, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		if isNumber(v) {
+			n := normNum(v)
+			if !isInt(n) || !bigOf(n).IsUint64() || rv.OverflowUint(bigOf(n).Uint64()) {
+				return rv, fmt.Errorf("%v doesn't fit %s", v, goTypeName(t))
+			}
+			rv.SetUint(bigOf(n).Uint64())
+			return rv, nil
+		}
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if isNone(v) {
+			return rv, nil
+		}
+		switch t.Kind() {
+		case reflect.Pointer:
+			if t.Implements(valueType) {
+				break
+			}
+			elem, err := c.toGo(v, t.Elem())
+			if err != nil {
+				return rv, err
+			}
+			rv.Set(reflect.New(t.Elem()))
+			rv.Elem().Set(elem)
+			return rv, nil
+		case reflect.Map:
+			if d, ok := v.(*Doc); ok {
+				return c.toGoMap(d, t)
+			}
+		case reflect.Slice:
+			switch a := v.(type) {
+			case *Array:
+				return c.toGoSlice(a, a.Elems, t)
+			case *Tuple:
+				return c.toGoSlice(a, a.Elems, t)
+			}
+		}
+	case reflect.Struct:
+		if d, ok := v.(*Doc); ok {
+			return c.toGoStruct(d, t)
+		}
+	}
+	return rv, fmt.Errorf("can't convert %s to %s", typeName(v), goTypeName(t))
+}
+
+// toGoAny converts a script value to its natural Go form: float64,
+// string, bool, nil, []any for lists and tuples and maps for other docs.
+func (c *converter) toGoAny(v Value) (reflect.Value, error) {
+	var out any
+	switch v := v.(type) {
+	case None:
+		return reflect.Zero(reflect.TypeFor[any]()), nil
+	case Bool:
+		out = bool(v)
+	case Num:
+		out = float64(v)
+	case Int:
+		out = int64(v)
+	case BigInt:
+		out = v.Big()
+	case Str:
+		out = string(v)
+	case *Array, *Tuple:
+		rv, err := c.toGo(v, reflect.TypeFor[[]any]())
+		if err != nil {
+			return rv, err
+		}
+		out = rv.Interface()
+	case *Doc:
+		t := reflect.TypeFor[map[any]any]()
+		if stringKeys(v) {
+			t = reflect.TypeFor[map[string]any]()
+		}
+		rv, err := c.toGo(v, t)
+		if err != nil {
+			return rv, err
+		}
+		out = rv.Interface()
+	case *Box:
+		if v.bound.IsValid() {
+			out = v.bound.Interface()
+		} else {
+			out = v
+		}
+	default:
+		out = v
+	}
+	rv := reflect.New(reflect.TypeFor[any]()).Elem()
+	rv.Set(reflect.ValueOf(out))
+	return rv, nil
+}
+
+func stringKeys(d *Doc) bool {
+	for key := range d.pairs {
+		if _, ok := key.(Str); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *converter) toGoSlice(a Value, elems []Value, t reflect.Type) (reflect.Value, error) {
+	if err := c.enter(a); err != nil {
+		return reflect.Value{}, err
+	}
+	defer delete(c.values, a)
+	rv := reflect.MakeSlice(t, len(elems), len(elems))
+	for i, v := range elems {
+		elem, err := c.toGo(v, t.Elem())
+		if err != nil {
+			return rv, fmt.Errorf("index %d: %w", i, err)
+		}
+		rv.Index(i).Set(elem)
+	}
+	return rv, nil
+}
+
+func (c *converter) toGoMap(d *Doc, t reflect.Type) (reflect.Value, error) {
+	if err := c.enter(d); err != nil {
+		return reflect.Value{}, err
+	}
+	defer delete(c.values, d)
+	rv := reflect.MakeMapWithSize(t, len(d.pairs))
+	for key, val := range d.pairs {
+		k, err := c.toGo(key, t.Key())
+		if err != nil {
+			return rv, fmt.Errorf("key %v: %w", key, err)
+		}
+		if !k.Comparable() {
+			return rv, fmt.Errorf("key %v: %s can't be a Go map key", key, typeName(key))
+		}
+		v, err := c.toGo(val, t.Elem())
+		if err != nil {
+			return rv, fmt.Errorf("key %v: %w", key, err)
+		}
+		rv.SetMapIndex(k, v)
+	}
+	return rv, nil
+}
+
+func (c *converter) toGoStruct(d *Doc, t reflect.Type) (reflect.Value, error) {
+	if err := c.enter(d); err != nil {
+		return reflect.Value{}, err
+	}
+	defer delete(c.values, d)
+	rv := reflect.New(t).Elem()
+	info := bindInfoOf(reflect.PointerTo(t))
+	for _, name := range info.names {
+		val, ok := d.pairs[Str(name)]
+		if !ok {
+			continue
+		}
+		field, err := rv.FieldByIndexErr(info.fields[name].index)
+		if err != nil {
+			return rv, fmt.Errorf("field %s: %w", name, err)
+		}
+		v, err := c.toGo(val, field.Type())
+		if err != nil {
+			return rv, fmt.Errorf("field %s: %w", name, err)
+		}
+		field.Set(v)
+	}
+	return rv, nil
+}
+
+func (c *converter) fromGo(rv reflect.Value) (Value, error) {
+	if !rv.IsValid() {
+		return None{}, nil
+	}
+	if rv.Type().Implements(valueType) {
+		if rv.Kind() == reflect.Interface || rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return None{}, nil
+			}
+		}
+		return rv.Interface().(Value), nil
+	}
+	if rv.Type() == bigIntType {
+		if rv.IsNil() {
+			return None{}, nil
+		}
+		return NewInt(rv.Interface().(*big.Int)), nil
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		return Bool(rv.Bool()), nil
+	case reflect.String:
+		return Str(rv.String()), nil
+	case reflect.Float32, reflect.Float64:
+		return Num(rv.Float()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		return intValue(new(big.Int).SetUint64(rv.Uint())), nil
+	case reflect.Interface:
+		return c.fromGo(rv.Elem())
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return None{}, nil
+		}
+		if rv.Elem().Kind() == reflect.Struct {
+			return bindValue(rv), nil
+		}
+		ref, err := c.enterGo(rv)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c.refs, ref)
+		return c.fromGo(rv.Elem())
+	case reflect.Struct:
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return bindValue(ptr), nil
+	case reflect.Func:
+		if rv.IsNil() {
+			return None{}, nil
+		}
+		return wrapFunc(rv, funcName(rv)), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return None{}, nil
+		}
+		if rv.Kind() == reflect.Slice {
+			ref, err := c.enterGo(rv)
+			if err != nil {
+				return nil, err
+			}
+			defer delete(c.refs, ref)
+		}
+		arr := &Array{Elems: make([]Value, rv.Len())}
+		for i := range rv.Len() {
+			v, err := c.fromGo(rv.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			arr.Elems[i] = v
+		}
+		return arr, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return None{}, nil
+		}
+		ref, err := c.enterGo(rv)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c.refs, ref)
+		pairs := make([][2]Value, 0, rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			k, err := c.fromGo(iter.Key())
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			v, err := c.fromGo(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			if !isNone(v) {
+				pairs = append(pairs, [2]Value{k, v})
+			}
+		}
+		// Go maps have no order, sorted keys keep the docs reproducible
+		slices.SortFunc(pairs, func(a, b [2]Value) int {
+			if c, err := compareValues(a[0], b[0]); err == nil {
+				return c
+			}
+			return strings.Compare(fmt.Sprint(a[0]), fmt.Sprint(b[0]))
+		})
+		doc := newDoc(len(pairs), nil)
+		for _, pair := range pairs {
+			doc.Set(pair[0], pair[1])
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("can't convert Go %s", rv.Type())
+}
+
+// callGo calls a Go function with script arguments, a trailing error
+// result is raised and the other results are returned. A first
+// parameter of type *Evaluator gets the calling evaluator, then self
+// is passed unless it is nil.
+func callGo(e *Evaluator, fn reflect.Value, name string, self Value, args []Value) []Value {
+	t := fn.Type()
+	in := make([]reflect.Value, 0, t.NumIn())
+	params := t.NumIn()
+	if params > 0 && t.In(0) == evaluatorType {
+		in = append(in, reflect.ValueOf(e))
+	}
+	if self != nil {
+		v, err := toGo(self, t.In(len(in)))
+		if err != nil {
+			Raise(newError("TypeError", "%s() receiver: %s", name, err))
+		}
+		in = append(in, v)
+	}
+	fixed := params - len(in)
+	if t.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			Raise(newError("TypeError", "%s() takes at least %d arguments but %d were given",
+				name, fixed, len(args)))
+		}
+	} else if len(args) != fixed {
+		Raise(newError("TypeError", "%s() takes %d arguments but %d were given",
+			name, fixed, len(args)))
+	}
+	for i, arg := range args {
+		var pt reflect.Type
+		if i < fixed {
+			pt = t.In(len(in))
+		} else {
+			pt = t.In(params - 1).Elem()
+		}
+		v, err := toGo(arg, pt)
+		if err != nil {
+			Raise(newError("TypeError", "%s() argument %d: %s", name, i+1, err))
+		}
+		in = append(in, v)
+	}
+	out := fn.Call(in)
+	if n := len(out); n > 0 && t.Out(n-1) == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			raiseGoError(err)
+		}
+		out = out[:n-1]
+	}
+	vals := make([]Value, len(out))
+	for i, rv := range out {
+		v, err := fromGo(rv)
+		if err != nil {
+			Raise(newError("TypeError", "%s() result %d: %s", name, i+1, err))
+		}
+		vals[i] = v
+	}
+	return vals
+}
+
+// raiseGoError raises an error returned by Go code. Errors of a nested
+// Call are raised again as they were and an *Error in the chain is
+// raised as is.
+func raiseGoError(err error) {
+	var le *LimitError
+	if errors.As(err, &le) {
+		if exc, ok := le.Err.(*RuntimeException); ok {
+			panic(exc)
+		}
+		panic(le)
+	}
+	var exc *RuntimeException
+	if errors.As(err, &exc) {
+		panic(exc)
+	}
+	var v *Error
+	if errors.As(err, &v) {
+		Raise(v)
+	}
+	Raise(newError("RuntimeError", "%s", err))
+}
@@ -0,0 +1,78 @@
+package yeva
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromGo(t *testing.T) {
+	v, err := FromGo(map[string]any{
+		"n":    3,
+		"f":    1.5,
+		"s":    "a",
+		"list": []int{1, 2},
+		"nil":  nil,
+		"deep": map[string][]string{"k": {"v"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := New()
+	e.Globals["cfg"] = v
+	if err := e.Interpret([]byte(`x = [cfg.n + 1, cfg.f, cfg.s, cfg.list[1], cfg.nil, cfg.deep.k[0]]`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != `[4, 1.5, "a", 2, None, "v"]` {
+		t.Errorf("x = %s", got)
+	}
+
+	if _, err := FromGo(make(chan int)); err == nil {
+		t.Error("FromGo(chan) didn't fail")
+	}
+}
+
+func TestToGo(t *testing.T) {
+	e := run(t, `
+x = {a: 1, b: [1.5, "s", None, True], c: (1, 2)}
+x[2] = "two"
+cyclic = {}
+cyclic.self = cyclic
+`)
+	got, err := ToGo(global(t, e, "x"))
+	want := map[any]any{
+		"a":      int64(1),
+		"b":      []any{1.5, "s", nil, true},
+		"c":      []any{int64(1), int64(2)},
+		int64(2): "two",
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ToGo(x) = %#v, %v, want %#v", got, err, want)
+	}
+	if _, err := ToGo(global(t, e, "cyclic")); err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Errorf("ToGo(cyclic) = %v", err)
+	}
+}
+
+func TestAs(t *testing.T) {
+	e := run(t, `
+x = {X: 1, Y: 2, label: "p"}
+xs = [1, 2, 3]
+m = {a: [1], b: [2, 3]}
+`)
+	p, err := As[point](e.Globals["x"])
+	if err != nil || p.X != 1 || p.Y != 2 || p.Label != "p" {
+		t.Errorf("As[point] = %+v, %v", p, err)
+	}
+	xs, err := As[[]int](e.Globals["xs"])
+	if err != nil || !reflect.DeepEqual(xs, []int{1, 2, 3}) {
+		t.Errorf("As[[]int] = %v, %v", xs, err)
+	}
+	m, err := As[map[string][]float64](e.Globals["m"])
+	if err != nil || !reflect.DeepEqual(m, map[string][]float64{"a": {1}, "b": {2, 3}}) {
+		t.Errorf("As[map] = %v, %v", m, err)
+	}
+	if _, err := As[[]string](e.Globals["xs"]); err == nil {
+		t.Error("As[[]string] of numbers didn't fail")
+	}
+}
@@ -0,0 +1,406 @@
+package yeva
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an exact decimal number, written with a 'd' suffix: 1.10d.
+// Sums, differences and products are exact, quotients are rounded to
+// Evaluator.DecimalPrecision significant digits.
+type Decimal struct {
+	coef  *big.Int // never changed once in a Decimal
+	scale int32    // digits after the point, not negative
+}
+
+// Rounding tells how decimals are rounded, RoundHalfEven is the default.
+type Rounding int
+
+const (
+	RoundHalfEven Rounding = iota // to the nearest, ties to even
+	RoundHalfUp                   // to the nearest, ties away from zero
+	RoundHalfDown                 // to the nearest, ties towards zero
+	RoundUp                       // away from zero
+	RoundDown                     // towards zero
+	RoundCeiling                  // towards +infinity
+	RoundFloor                    // towards -infinity
+)
+
+// roundingNames are the names of the roundings in scripts.
+var roundingNames = map[string]Rounding{
+	"half_even": RoundHalfEven,
+	"half_up":   RoundHalfUp,
+	"half_down": RoundHalfDown,
+	"up":        RoundUp,
+	"down":      RoundDown,
+	"ceiling":   RoundCeiling,
+	"floor":     RoundFloor,
+}
+
+const defaultDecimalPrecision = 28
+
+// NewDecimal gives the decimal coef * 10**-scale.
+func NewDecimal(coef *big.Int, scale int32) (Decimal, error) {
+	if scale < 0 {
+		return Decimal{}, fmt.Errorf("decimal: negative scale %d", scale)
+	}
+	return Decimal{new(big.Int).Set(coef), scale}, nil
+}
+
+// ParseDecimal parses a decimal such as "-12.50", underscores are
+// allowed between digits.
+func ParseDecimal(s string) (Decimal, error) {
+	digits := strings.ReplaceAll(s, "_", "")
+	sign := ""
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		sign, digits = digits[:1], digits[1:]
+	}
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("decimal: invalid syntax %q", s)
+	}
+	coef, _ := new(big.Int).SetString(sign+whole+frac, 10)
+	return Decimal{coef, int32(len(frac))}, nil
+}
+
+// DecimalFromFloat gives the shortest decimal that reads back as f.
+func DecimalFromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("decimal: can't convert %v", f)
+	}
+	return ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// Coef gives a copy of the digits of the decimal as an integer.
+func (d Decimal) Coef() *big.Int {
+	return new(big.Int).Set(d.coef)
+}
+
+// Scale gives the number of digits after the point.
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Rat gives the decimal as a fraction.
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.coef, pow10(d.scale))
+}
+
+// Float64 gives the float nearest to the decimal.
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+func (d Decimal) String() string {
+	s := new(big.Int).Abs(d.coef).String()
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(s); pad > 0 {
+			s = strings.Repeat("0", pad) + s
+		}
+		s = s[:len(s)-int(d.scale)] + "." + s[len(s)-int(d.scale):]
+	}
+	if d.coef.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func (d Decimal) Index(key Value) Value {
+	return protoDecimal.Index(key)
+}
+
+func (d Decimal) Prototype() *Prototype {
+	return &protoDecimal
+}
+
+var protoDecimal Prototype = protoOf(map[Value]Value{
+	Str("round"): decimalMethod("round", func(e *Evaluator, d Decimal, places int, mode ...string) (Decimal, error) {
+		if places < 0 || places > math.MaxInt32 {
+			return Decimal{}, newError("ValueError", "can't round to %d places", places)
+		}
+		rounding := e.DecimalRounding
+		if len(mode) > 0 {
+			r, ok := roundingNames[mode[0]]
+			if !ok {
+				return Decimal{}, newError("ValueError", "unknown rounding '%s'", mode[0])
+			}
+			rounding = r
+		}
+		return d.rescale(int32(places), rounding), nil
+	}),
+})
+
+func decimalMethod(name string, fn any) *NativeFunc {
+	return wrapMethod(name, "a Decimal", isDecimal, fn)
+}
+
+func isDecimal(v Value) bool {
+	_, ok := v.(Decimal)
+	return ok
+}
+
+var nativeDecimal = wrapFunc(reflect.ValueOf(func(v Value) (Decimal, error) {
+	switch v := v.(type) {
+	case Decimal:
+		return v, nil
+	case Int, BigInt:
+		return Decimal{bigOf(v), 0}, nil
+	case Num:
+		if d, err := DecimalFromFloat(float64(v)); err == nil {
+			return d, nil
+		}
+	case Str:
+		if d, err := ParseDecimal(strings.TrimSpace(string(v))); err == nil {
+			return d, nil
+		}
+	}
+	return Decimal{}, newError("ValueError", "can't convert %s %v to Decimal", typeName(v), v)
+}), "decimal")
+
+var pow10s [40]*big.Int
+
+func init() {
+	for i := range pow10s {
+		pow10s[i] = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(i)), nil)
+	}
+}
+
+// pow10 gives 10**n, the result must not be changed.
+func pow10(n int32) *big.Int {
+	if int(n) < len(pow10s) {
+		return pow10s[n]
+	}
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// decimalOf converts a decimal or an integer to a decimal.
+func decimalOf(v Value) (Decimal, bool) {
+	switch v := v.(type) {
+	case Decimal:
+		return v, true
+	case Int, BigInt:
+		return Decimal{bigOf(v), 0}, true
+	}
+	return Decimal{}, false
+}
+
+// align gives the coefficients of a and b at the same scale.
+func align(a, b Decimal) (x, y *big.Int, scale int32) {
+	switch {
+	case a.scale < b.scale:
+		return new(big.Int).Mul(a.coef, pow10(b.scale-a.scale)), b.coef, b.scale
+	case a.scale > b.scale:
+		return a.coef, new(big.Int).Mul(b.coef, pow10(a.scale-b.scale)), a.scale
+	}
+	return a.coef, b.coef, a.scale
+}
+
+// rescale rounds d to scale digits after the point, or pads it with
+// zeros.
+func (d Decimal) rescale(scale int32, mode Rounding) Decimal {
+	if scale >= d.scale {
+		return Decimal{new(big.Int).Mul(d.coef, pow10(scale-d.scale)), scale}
+	}
+	return Decimal{roundQuo(d.coef, pow10(d.scale-scale), mode), scale}
+}
+
+// trim drops trailing zeros after the point down to scale digits.
+func (d Decimal) trim(scale int32) Decimal {
+	ten := big.NewInt(10)
+	q, r := new(big.Int), new(big.Int)
+	for d.scale > scale {
+		q.QuoRem(d.coef, ten, r)
+		if r.Sign() != 0 {
+			break
+		}
+		d = Decimal{new(big.Int).Set(q), d.scale - 1}
+	}
+	return d
+}
+
+// roundQuo divides x by y and rounds the quotient to an integer.
+func roundQuo(x, y *big.Int, mode Rounding) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	sign := x.Sign() * y.Sign()
+	var away bool
+	switch mode {
+	case RoundUp:
+		away = true
+	case RoundDown:
+	case RoundCeiling:
+		away = sign > 0
+	case RoundFloor:
+		away = sign < 0
+	default:
+		half := new(big.Int).Abs(r)
+		half.Lsh(half, 1)
+		switch half.CmpAbs(y) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == RoundHalfUp || mode == RoundHalfEven && q.Bit(0) == 1
+		}
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}
+
+func (e *Evaluator) decimalPrecision() int32 {
+	if e.DecimalPrecision > 0 {
+		return int32(min(e.DecimalPrecision, math.MaxInt32/2))
+	}
+	return defaultDecimalPrecision
+}
+
+// decimalOperation applies an arithmetic operator to decimals and
+// integers, floats don't mix with decimals.
+func (e *Evaluator) decimalOperation(a, b Value, op tokenType) Value {
+	x, ok1 := decimalOf(a)
+	y, ok2 := decimalOf(b)
+	if !ok1 || !ok2 {
+		Raise(newError("TypeError", "unsupported operand types: %s and %s",
+			typeName(a), typeName(b)))
+	}
+	var res Decimal
+	switch op {
+	case tokenPlus:
+		xc, yc, scale := align(x, y)
+		res = Decimal{new(big.Int).Add(xc, yc), scale}
+	case tokenMinus:
+		xc, yc, scale := align(x, y)
+		res = Decimal{new(big.Int).Sub(xc, yc), scale}
+	case tokenStar:
+		e.alloc((x.coef.BitLen() + y.coef.BitLen()) / 8)
+		res = Decimal{new(big.Int).Mul(x.coef, y.coef), x.scale + y.scale}
+	case tokenSlash:
+		res = e.divideDecimals(x, y)
+	case tokenSlashSlash, tokenPersent:
+		if y.coef.Sign() == 0 {
+			Raise(newError("ZeroDivisionError", "decimal division or modulo by zero"))
+		}
+		xc, yc, scale := align(x, y)
+		q := roundQuo(xc, yc, RoundFloor)
+		if op == tokenSlashSlash {
+			res = Decimal{q, 0}
+		} else {
+			r := new(big.Int).Mul(q, yc)
+			res = Decimal{r.Sub(xc, r), scale}
+		}
+	case tokenStarStar:
+		if !isInt(b) {
+			Raise(newError("TypeError", "decimal powers must be integers, not %s", typeName(b)))
+		}
+		n := bigOf(b)
+		if n.Sign() < 0 {
+			return e.divideDecimals(Decimal{big.NewInt(1), 0},
+				e.decimalPower(x, new(big.Int).Neg(n)))
+		}
+		res = e.decimalPower(x, n)
+	default:
+		panic("decimal operation: unknown operation")
+	}
+	return res
+}
+
+// decimalPower raises x to a power n >= 0, which can be big when x is
+// an integer of 0, 1 or -1.
+func (e *Evaluator) decimalPower(x Decimal, n *big.Int) Decimal {
+	if x.scale == 0 && x.coef.CmpAbs(big.NewInt(1)) <= 0 {
+		return Decimal{new(big.Int).Exp(x.coef, n, nil), 0}
+	}
+	if !n.IsInt64() || n.Int64() > math.MaxInt32 || int64(x.scale)*n.Int64() > math.MaxInt32 {
+		Raise(newError("MemoryError", "decimal power is too big"))
+	}
+	e.alloc(x.coef.BitLen() * int(n.Int64()) / 8)
+	return Decimal{new(big.Int).Exp(x.coef, n, nil), x.scale * int32(n.Int64())}
+}
+
+// divideDecimals divides to DecimalPrecision significant digits, exact
+// quotients keep no more digits than the operands need.
+func (e *Evaluator) divideDecimals(x, y Decimal) Decimal {
+	if y.coef.Sign() == 0 {
+		Raise(newError("ZeroDivisionError", "decimal division by zero"))
+	}
+	ideal := max(x.scale-y.scale, 0)
+	prec := e.decimalPrecision()
+	// digits before the point of the quotient, or one less
+	whole := digits(x.coef) - x.scale - (digits(y.coef) - y.scale)
+	scale := max(prec-whole, ideal)
+	num, den := scaleQuo(x, y, scale)
+	if q := new(big.Int).Quo(num, den); digits(q) > prec && scale > ideal {
+		scale--
+		num, den = scaleQuo(x, y, scale)
+	}
+	res := Decimal{roundQuo(num, den, e.DecimalRounding), scale}
+	return res.trim(ideal)
+}
+
+// scaleQuo gives the fraction x / y times 10**scale.
+func scaleQuo(x, y Decimal, scale int32) (num, den *big.Int) {
+	num, den = new(big.Int).Set(x.coef), new(big.Int).Set(y.coef)
+	if shift := scale + y.scale - x.scale; shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	return num, den
+}
+
+// digits gives the number of decimal digits of x.
+func digits(x *big.Int) int32 {
+	return int32(len(new(big.Int).Abs(x).String()))
+}
+
+// normDecimal gives an integral decimal as an integer and one equal to
+// a float as the float, see normNum.
+func normDecimal(d Decimal) Value {
+	if t := d.trim(0); t.scale == 0 {
+		return intValue(t.coef)
+	}
+	if f := d.Float64(); !math.IsInf(f, 0) && new(big.Rat).SetFloat64(f).Cmp(d.Rat()) == 0 {
+		return Num(f)
+	}
+	return d
+}
+
+// compareDecimals is compareNums for a decimal and another number.
+func compareDecimals(a, b Value) (int, bool) {
+	ra, ok1 := ratOf(a)
+	rb, ok2 := ratOf(b)
+	if ok1 && ok2 {
+		return ra.Cmp(rb), true
+	}
+	fa, ok1 := floatOf(a)
+	fb, ok2 := floatOf(b)
+	if !ok1 || !ok2 || math.IsNaN(fa) || math.IsNaN(fb) {
+		return 0, false
+	}
+	return cmp.Compare(fa, fb), true // an infinity
+}
+
+// ratOf converts a finite number to a fraction.
+func ratOf(v Value) (*big.Rat, bool) {
+	switch v := v.(type) {
+	case Decimal:
+		return v.Rat(), true
+	case Int, BigInt:
+		return new(big.Rat).SetInt(bigOf(v)), true
+	case Num:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(float64(v)), true
+	}
+	return nil, false
+}
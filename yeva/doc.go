@@ -0,0 +1,287 @@
+package yeva
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// NewDoc makes a doc of the keys paired with the values, in order. It
+// panics if there are more keys than values or the other way round.
+func NewDoc(keys, values []Value) *Doc {
+	if len(keys) != len(values) {
+		panic("new doc: keys and values differ in length")
+	}
+	d := newDoc(len(keys), nil)
+	for i, key := range keys {
+		d.Set(key, values[i])
+	}
+	return d
+}
+
+// Get gives the value of a key of d itself, not of its prototype, and
+// whether d has the key.
+func (d *Doc) Get(key Value) (Value, bool) {
+	v, ok := d.pairs[d.key(nil, key)]
+	return v, ok
+}
+
+// All gives the pairs in insertion order. Keys deleted while iterating
+// are skipped and keys added aren't visited.
+func (d *Doc) All() iter.Seq2[Value, Value] {
+	return func(yield func(Value, Value) bool) {
+		for _, key := range d.Keys() {
+			if v, ok := d.pairs[key]; ok && !yield(key, v) {
+				return
+			}
+		}
+	}
+}
+
+// Set sets the value of a key, new keys are ordered after the others.
+func (d *Doc) Set(key, val Value) {
+	d.set(nil, key, val)
+}
+
+// Delete removes a key.
+func (d *Doc) Delete(key Value) {
+	d.delete(nil, key)
+}
+
+// Keys gives the keys in insertion order.
+func (d *Doc) Keys() []Value {
+	keys := make([]Value, 0, len(d.pairs))
+	for _, key := range d.keys {
+		if key != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (d *Doc) Len() int {
+	return len(d.pairs)
+}
+
+// newDoc makes a doc with room for n pairs.
+func newDoc(n int, proto *Prototype) *Doc {
+	return &Doc{
+		pairs: make(map[Value]Value, n),
+		Proto: proto,
+		keys:  make([]Value, 0, n),
+		index: make(map[Value]int, n),
+	}
+}
+
+// protoOf makes a doc of the methods of a prototype, a map has no
+// order, so the keys are sorted.
+func protoOf(methods map[Value]Value) *Doc {
+	keys := slices.SortedFunc(maps.Keys(methods), func(a, b Value) int {
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	})
+	d := newDoc(len(keys), nil)
+	for _, key := range keys {
+		d.Set(key, methods[key])
+	}
+	return d
+}
+
+// compact drops deleted keys from the order.
+func (d *Doc) compact() {
+	keys := d.keys[:0]
+	for _, key := range d.keys {
+		if key != nil {
+			d.index[key] = len(keys)
+			keys = append(keys, key)
+		}
+	}
+	clear(d.keys[len(keys):])
+	d.keys = keys
+}
+
+// key gives the key of d equal to key, so that equal numbers, tuples,
+// frozen docs and values with '__hash__' find the same pair. e can be nil,
+// then '__eq__' and '__hash__' aren't called.
+func (d *Doc) key(e *Evaluator, key Value) Value {
+	key = normNum(key)
+	if _, ok := d.pairs[key]; ok || !e.structural(key) {
+		return key
+	}
+	for _, k := range d.hashed[e.hash(key)] {
+		if _, ok := d.pairs[k]; ok && e.equal(k, key) {
+			return k
+		}
+	}
+	return key
+}
+
+// get is Index comparing keys with e.
+func (d *Doc) get(e *Evaluator, key Value) Value {
+	for {
+		if v, ok := d.pairs[d.key(e, key)]; ok {
+			return v
+		}
+		if d.Proto == nil {
+			return None{}
+		}
+		proto, ok := (*d.Proto).(*Doc)
+		if !ok {
+			return (*d.Proto).Index(key)
+		}
+		d = proto
+	}
+}
+
+// set is Set comparing keys with e.
+func (d *Doc) set(e *Evaluator, key, val Value) {
+	if d.module && e != nil {
+		e.epoch++
+	}
+	key = d.key(e, key)
+	if _, ok := d.pairs[key]; !ok {
+		if d.pairs == nil {
+			d.pairs = make(map[Value]Value)
+			d.index = make(map[Value]int)
+		}
+		d.index[key] = len(d.keys)
+		d.keys = append(d.keys, key)
+		d.hashKey(e, key)
+	}
+	d.pairs[key] = val
+}
+
+// delete is Delete comparing keys with e.
+func (d *Doc) delete(e *Evaluator, key Value) {
+	if d.module && e != nil {
+		e.epoch++
+	}
+	key = d.key(e, key)
+	if i, ok := d.index[key]; ok {
+		d.keys[i] = nil
+		delete(d.index, key)
+		d.unhashKey(e, key)
+		if len(d.index) < len(d.keys)/2 {
+			d.compact()
+		}
+	}
+	delete(d.pairs, key)
+}
+
+func (d *Doc) hashKey(e *Evaluator, key Value) {
+	if !e.structural(key) {
+		return
+	}
+	if d.hashed == nil {
+		d.hashed = make(map[uint64][]Value)
+	}
+	h := e.hash(key)
+	d.hashed[h] = append(d.hashed[h], key)
+}
+
+func (d *Doc) unhashKey(e *Evaluator, key Value) {
+	if !e.structural(key) {
+		return
+	}
+	h := e.hash(key)
+	keys := d.hashed[h]
+	if i := slices.Index(keys, key); i >= 0 {
+		keys = slices.Delete(keys, i, i+1)
+	}
+	if len(keys) == 0 {
+		delete(d.hashed, h)
+	} else {
+		d.hashed[h] = keys
+	}
+}
+
+// checkFrozen raises when a script changes a frozen doc.
+func (d *Doc) checkFrozen() {
+	if d.frozen {
+		Raise(newError("TypeError", "frozen doc can't be changed"))
+	}
+}
+
+// nativeFreeze copies a doc into a frozen one, which can't be changed
+// and equals frozen docs with equal pairs.
+var nativeFreeze = wrapFunc(reflect.ValueOf(func(e *Evaluator, d *Doc) *Doc {
+	if d.frozen {
+		return d
+	}
+	e.alloc(d.Len() * pairSize)
+	frozen := newDoc(d.Len(), d.Proto)
+	for _, key := range d.Keys() {
+		frozen.set(e, key, d.pairs[key])
+	}
+	frozen.frozen = true
+	return frozen
+}), "freeze")
+
+// protoDoc holds the methods every doc reaches through '->' when its
+// prototypes don't have them.
+var protoDoc Prototype = protoOf(map[Value]Value{
+	Str("keys"): docMethod("keys", func(e *Evaluator, d *Doc) *Array {
+		return newArray(e, d.Keys())
+	}),
+	Str("values"): docMethod("values", func(e *Evaluator, d *Doc) *Array {
+		keys := d.Keys()
+		for i, key := range keys {
+			keys[i] = d.pairs[key]
+		}
+		return newArray(e, keys)
+	}),
+	Str("items"): docMethod("items", func(e *Evaluator, d *Doc) *Array {
+		keys := d.Keys()
+		items := make([]Value, len(keys))
+		e.alloc(len(keys) * 2 * valueSize)
+		for i, key := range keys {
+			items[i] = &Tuple{Elems: []Value{key, d.pairs[key]}}
+		}
+		return newArray(e, items)
+	}),
+	Str("has"): docMethod("has", func(e *Evaluator, d *Doc, key Value) bool {
+		_, ok := d.pairs[d.key(e, key)]
+		return ok
+	}),
+	Str("get"): docMethod("get", func(e *Evaluator, d *Doc, key Value, def ...Value) Value {
+		if v, ok := d.pairs[d.key(e, key)]; ok {
+			return v
+		}
+		return first(def)
+	}),
+	Str("pop"): docMethod("pop", func(e *Evaluator, d *Doc, key Value, def ...Value) (Value, error) {
+		d.checkFrozen()
+		v, ok := d.pairs[d.key(e, key)]
+		if !ok {
+			if len(def) == 0 {
+				return nil, newError("KeyError", "%v", key)
+			}
+			return def[0], nil
+		}
+		d.delete(e, key)
+		return v, nil
+	}),
+	Str("update"): docMethod("update", func(e *Evaluator, d *Doc, other *Doc) {
+		for _, key := range other.Keys() {
+			e.setIndex(d, key, other.pairs[key])
+		}
+	}),
+	Str("clear"): docMethod("clear", func(d *Doc) {
+		d.checkFrozen()
+		d.pairs, d.keys, d.index, d.hashed = nil, nil, nil, nil
+	}),
+	Str("len"): docMethod("len", func(d *Doc) int {
+		return d.Len()
+	}),
+})
+
+func isDoc(v Value) bool {
+	_, ok := v.(*Doc)
+	return ok
+}
+
+func docMethod(name string, fn any) *NativeFunc {
+	return wrapMethod(name, "a Doc", isDoc, fn)
+}
@@ -0,0 +1,165 @@
+package yeva
+
+import "testing"
+
+func TestDocMethods(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"insertion order", `
+d = {}
+for k in ["z", "a", "m", "b"]:
+    d[k] = 1
+d["a"] = None
+d["a"] = 2
+x = d->keys()
+`, `["z", "m", "b", "a"]`},
+		{"values", `x = {b: 1, a: 2}->values()`, "[1, 2]"},
+		{"items", `x = {b: 1, a: 2}->items()`, `[("b", 1), ("a", 2)]`},
+		{"items loop", `
+x = []
+for k, v in {b: 1, a: 2}->items():
+    x->push(k)
+    x->push(v)
+`, `["b", 1, "a", 2]`},
+		{"has", `x = [{a: 1}->has("a"), {a: 1}->has("b")]`, "[True, False]"},
+		{"get", `x = [{a: 1}->get("a"), {a: 1}->get("b", 5), {a: 1}->get("b")]`, "[1, 5, None]"},
+		{"pop", `
+d = {a: 1, b: 2}
+x = [d->pop("a"), d->pop("a", 0), d->len()]
+`, "[1, 0, 1]"},
+		{"update", `
+x = {a: 1, b: 2}
+x->update({b: 3, c: 4})
+`, `{"a": 1, "b": 3, "c": 4}`},
+		{"clear", `
+d = {a: 1}
+d->clear()
+d["b"] = 2
+x = d->keys()
+`, `["b"]`},
+		{"prototype first", `
+P = { len: lambda self: "mine" }
+x = P{ a: 1 }->len()
+`, `"mine"`},
+	})
+
+	if err := New().Interpret([]byte(`x = {}->pop("a")`)); err == nil {
+		t.Error("pop of a missing key didn't fail")
+	}
+}
+
+func TestDocKeys(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"numbers", `
+d = {}
+d[1] = "a"
+x = d[1.0]
+`, `"a"`},
+		{"tuples", `
+d = {}
+d[(1, "a")] = 5
+x = d[(1, "a")]
+`, "5"},
+		{"frozen docs", `
+d = {}
+d[freeze({a: 1, b: 2})] = 5
+x = d[freeze({b: 2, a: 1})]
+`, "5"},
+		{"docs by identity", `
+d = {}
+d[{a: 1}] = 5
+x = d[{a: 1}]
+`, "None"},
+		{"eq and hash", `
+P = {}
+P.__eq__ = lambda self other: self.id == other.id
+P.__hash__ = lambda self: self.id
+d = {}
+d[P{ id: 1 }] = "one"
+x = [d[P{ id: 1 }], P{ id: 2 } == P{ id: 2 }, P{ id: 1 } != P{ id: 2 }]
+`, `["one", True, True]`},
+		{"tuple methods", `x = [(1, 2, 3)->length(), (1, 2)->index_of(2), (1, 2)->to_list()]`, "[3, 1, [1, 2]]"},
+		{"tuple builtin", `x = tuple([1, 2]) == (1, 2)`, "True"},
+		{"tuple value", `x = (1, "a")`, `(1, "a")`},
+	})
+
+	for _, source := range []string{
+		"t = (1, 2)\nt[0] = 5\n",
+		"d = freeze({a: 1})\nd.a = 2\n",
+	} {
+		if err := New().Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%q) didn't fail", source)
+		}
+	}
+}
+
+func TestDocGo(t *testing.T) {
+	d := &Doc{}
+	d.Set(Str("b"), Int(1))
+	d.Set(Str("a"), Num(2))
+	d.Set(Int(1), Str("one"))
+	d.Delete(Str("b"))
+	keys := d.Keys()
+	if len(keys) != 2 || keys[0] != Str("a") || keys[1] != Int(1) || d.Len() != 2 {
+		t.Errorf("Keys() = %v", keys)
+	}
+	if v := d.Index(Num(1)); v != Str("one") {
+		t.Errorf("Index(1.0) = %v", v)
+	}
+}
+
+func TestNewDoc(t *testing.T) {
+	d := NewDoc([]Value{Str("b"), Int(1), Str("a")}, []Value{Int(1), Str("one"), None{}})
+	var keys, values []Value
+	for k, v := range d.All() {
+		keys = append(keys, k)
+		values = append(values, v)
+		d.Delete(Int(1))
+	}
+	if show(&Tuple{keys}) != `("b", "a")` || show(&Tuple{values}) != "(1, None)" {
+		t.Errorf("All() = %v, %v", keys, values)
+	}
+	if v, ok := d.Get(Str("a")); !ok || v != (None{}) {
+		t.Errorf("Get(a) = %v, %v", v, ok)
+	}
+	if _, ok := d.Get(Int(1)); ok {
+		t.Error("Get of a deleted key found it")
+	}
+
+	p := Prototype(NewDoc([]Value{Str("x")}, []Value{Int(1)}))
+	d.Proto = &p
+	if _, ok := d.Get(Str("x")); ok {
+		t.Error("Get looked in the prototype")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewDoc with fewer values didn't panic")
+		}
+	}()
+	NewDoc([]Value{Str("a")}, nil)
+}
+
+func TestDocOrderFromGo(t *testing.T) {
+	v, err := FromGo(map[string]int{"b": 1, "a": 2, "c": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := New()
+	e.Globals["d"] = v
+	if err := e.Interpret([]byte(`
+d.a = None
+d.z = 4
+d.a = 5
+x = d->keys()
+`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != `["b", "c", "z", "a"]` {
+		t.Errorf("keys = %s", got)
+	}
+
+	keys := protoDoc.(*Doc).Keys()
+	if len(keys) != protoDoc.(*Doc).Len() || keys[0] != Str("clear") {
+		t.Errorf("protoDoc keys = %v", keys)
+	}
+}
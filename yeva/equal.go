@@ -0,0 +1,110 @@
+package yeva
+
+import "hash/maphash"
+
+var hashSeed = maphash.MakeSeed()
+
+// equal compares values with '__eq__' of their prototypes, numbers by
+// their values, tuples by their elements and frozen docs by their
+// pairs. Other values are equal when they are the same. e can be nil,
+// then '__eq__' isn't called.
+func (e *Evaluator) equal(a, b Value) bool {
+	if e != nil {
+		if eq := protoMethod(a, "__eq__"); eq != nil {
+			return bool(e.truthy(first(eq.call(e, one(b)))))
+		}
+		if eq := protoMethod(b, "__eq__"); eq != nil {
+			return bool(e.truthy(first(eq.call(e, one(a)))))
+		}
+	}
+	if isNumber(a) && isNumber(b) {
+		c, ok := compareNums(a, b)
+		return ok && c == 0
+	}
+	switch a := a.(type) {
+	case *Tuple:
+		b, ok := b.(*Tuple)
+		if !ok || len(a.Elems) != len(b.Elems) {
+			return false
+		}
+		for i := range a.Elems {
+			if !e.equal(a.Elems[i], b.Elems[i]) {
+				return false
+			}
+		}
+		return true
+	case *Doc:
+		b, ok := b.(*Doc)
+		if !ok || a == b || !a.frozen || !b.frozen {
+			return ok && a == b
+		}
+		if a.Len() != b.Len() {
+			return false
+		}
+		for key, av := range a.pairs {
+			bv, ok := b.pairs[b.key(e, key)]
+			if !ok || !e.equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// hash gives values that are equal the same hash. Values with
+// '__hash__' in their prototypes are hashed by the value it returns, so
+// prototypes defining '__eq__' should define it too. e can be nil, then
+// '__hash__' isn't called.
+func (e *Evaluator) hash(v Value) uint64 {
+	if e != nil {
+		if hash := protoMethod(v, "__hash__"); hash != nil {
+			return e.hash(first(hash.call(e, nil)))
+		}
+	}
+	switch v := v.(type) {
+	case *Tuple:
+		var h maphash.Hash
+		h.SetSeed(hashSeed)
+		for _, elem := range v.Elems {
+			maphash.WriteComparable(&h, e.hash(elem))
+		}
+		return h.Sum64()
+	case *Doc:
+		if v.frozen {
+			var sum uint64 // pairs are unordered
+			for key, val := range v.pairs {
+				sum += maphash.Comparable(hashSeed, [2]uint64{e.hash(key), e.hash(val)})
+			}
+			return sum
+		}
+	case Num:
+		switch n := normNum(v).(type) {
+		case Int, BigInt:
+			return e.hash(n) // as the equal integer
+		}
+	case BigInt:
+		return maphash.String(hashSeed, v.v.String())
+	case Decimal:
+		n := normNum(v)
+		if d, ok := n.(Decimal); ok {
+			return maphash.String(hashSeed, d.trim(0).String())
+		}
+		return e.hash(n) // as the equal integer or float
+	}
+	return maphash.Comparable(hashSeed, v)
+}
+
+// structural tells whether docs look key up by hash and equal instead
+// of by identity.
+func (e *Evaluator) structural(key Value) bool {
+	switch key := key.(type) {
+	case *Tuple, BigInt, Decimal:
+		return true
+	case *Doc:
+		return key.frozen || e != nil && protoMethod(key, "__hash__") != nil
+	case *Box:
+		return e != nil && protoMethod(key, "__hash__") != nil
+	}
+	return false
+}
@@ -1,36 +1,149 @@
 package yeva
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
-type returnSignal []Value
-type continueSignal struct{}
-type breakSignal struct{}
+// RuntimeException is a value raised by a script and not caught by it.
+type RuntimeException struct {
+	Value Value
+	File  string       // file the exception was raised in
+	Trace []TraceFrame // innermost call last
+}
+
+type Limit string
 
-type runtimeException struct {
-	value Value
+const (
+	LimitSteps   Limit = "steps"
+	LimitContext Limit = "context"
+	LimitDepth   Limit = "depth"
+	LimitMemory  Limit = "memory"
+)
+
+// errorLimits are the limits behind errors raised by the Evaluator itself.
+var errorLimits = map[string]Limit{
+	"RecursionError": LimitDepth,
+	"MemoryError":    LimitMemory,
+}
+
+// LimitError is returned from Interpret and Call when a script hits a limit
+// of the Evaluator. Err is the context error or the uncaught RecursionError
+// or MemoryError.
+type LimitError struct {
+	Limit Limit
+	Err   error
+}
+
+const (
+	defaultMaxDepth = 10000
+	checkInterval   = 1024 // steps between limit checks
+
+	// approximate sizes in bytes for memory accounting
+	valueSize = 16
+	pairSize  = 3 * valueSize // key, value and map overhead
+	frameSize = 128           // frame and env
+
+	tracebackRepeats = 3 // equal frames printed before they are collapsed
+)
+
+type TraceFrame struct {
+	Func string
+	File string // empty for native functions
+	Line int
+	Col  int
 }
 
 type env struct {
-	store map[varName]Value
-	types map[varName]varType
+	slots []Value
 	encl  *env
 }
 
-func newEnv(encl *env) *env {
+func newEnv(encl *env, size int) *env {
 	return &env{
-		store: make(map[varName]Value),
+		slots: make([]Value, size),
 		encl:  encl,
-		types: make(map[varName]varType),
 	}
 }
 
+func (en *env) outer(depth int) *env {
+	for range depth {
+		en = en.encl
+	}
+	return en
+}
+
+type frame struct {
+	fn       *Func
+	native   *NativeFunc // set for native calls, which have no code
+	ip       int
+	base     int        // stack index of the callee, results are placed here
+	want     int        // results expected by the caller
+	handlers int        // handler stack size on entry
+	env      *env       // nil for the main code
+	gen      *Generator // set for the frames of generators
+}
+
+func (fr *frame) readByte() int {
+	fr.ip++
+	return fr.fn.Code.readByte(fr.ip - 1)
+}
+
+func (fr *frame) readShort() int {
+	fr.ip += 2
+	return fr.fn.Code.readShort(fr.ip - 2)
+}
+
+type handler struct {
+	frames  int // frame stack size when set up
+	sp      int
+	ip      int
+	finally bool // runs a finally block and raises the exception again
+}
+
+type iterValue struct {
+	next Iterator
+}
+
+func (v *iterValue) Type()          {}
+func (v *iterValue) String() string { return "[iterator Iterator]" }
+
+// pendingException is an exception kept on the stack while a finally
+// block runs before it's raised again.
+type pendingException struct {
+	exc *RuntimeException
+}
+
+func (v *pendingException) Type()          {}
+func (v *pendingException) String() string { return "[exception Exception]" }
+
 type Evaluator struct {
-	Globals map[varName]Value
-	*env
+	Globals   map[varName]Value
+	Context   context.Context // stops scripts once done, can be nil
+	MaxSteps  int             // steps of one Interpret or Call, 0 for no limit
+	MaxDepth  int             // depth of calls, 0 for no limit
+	MaxMemory int             // bytes allocated in total by one Interpret or Call, 0 for no limit
+	Loader    ModuleLoader    // finds imported modules, can be nil
+
+	DecimalPrecision int      // significant digits of decimal quotients, 28 when 0
+	DecimalRounding  Rounding // rounds decimal quotients and '->round'
+
+	steps     int
+	tick      int  // steps left until the next limit check
+	slice     int  // steps between the last two limit checks
+	memory    int  // bytes accounted for strings, doc pairs and frames
+	memoryOut bool // MemoryError was raised
+	epoch     int  // changes when globals might change behind globalSlots
+	stack     []Value
+	frames    []*frame
+	handlers  []handler
+	nvals     int // values pushed by the last spread call
+	modules   map[string]*module
+	importing []string // files of the modules being evaluated
 }
 
 func New() *Evaluator {
@@ -38,401 +151,908 @@ func New() *Evaluator {
 		Globals: map[varName]Value{
 			"println": &nativePrintln,
 			"random":  &nativeRandom,
+			"tuple":   nativeTuple,
+			"freeze":  nativeFreeze,
+			"int":     nativeInt,
+			"float":   nativeFloat,
+			"decimal": nativeDecimal,
 		},
-		env: newEnv(nil),
+		MaxDepth: defaultMaxDepth,
 	}
 }
 
-func (e *Evaluator) Interpret(source []byte) (err error) {
-	defer catch(func(exc runtimeException) {
-		fmt.Println(exc) // remove this!
-		err = exc
+func (e *Evaluator) Interpret(source []byte) error {
+	return e.InterpretFile("<script>", source)
+}
+
+// InterpretFile runs source, file names it in compile errors and tracebacks.
+func (e *Evaluator) InterpretFile(file string, source []byte) (err error) {
+	e.resetLimits()
+	e.epoch++
+	defer catch(e.catchLimit(&err))
+	defer catch(e.catchException(&err))
+
+	code, err := compileSource(file, source)
+	if err != nil {
+		return err
+	}
+	main := &Func{Code: code, Name: code.name}
+	e.push(main)
+	e.frames = append(e.frames, &frame{
+		fn:       main,
+		base:     len(e.stack) - 1,
+		handlers: len(e.handlers),
 	})
+	e.run(len(e.frames) - 1)
+	return
+}
+
+func compileSource(file string, source []byte) (*funcCode, error) {
 	p := newParser(source)
 	ast, err := p.parse()
 	if err != nil {
-		return fmt.Errorf("compile error: %w", err)
+		return nil, fmt.Errorf("compile error: %w", err)
+	}
+	globals, err := resolve(ast)
+	if err != nil {
+		return nil, fmt.Errorf("compile error: %w", err)
 	}
 	if debugPrintAST {
 		p := &printer{}
 		fmt.Println(cover("ast", 12, "="))
 		fmt.Println(p.sprintProgram(ast))
-		fmt.Println(cover("runtime", 12, "="))
 	}
-	for _, stmt := range ast {
-		e.eval(stmt)
+	code, err := compile(file, ast, globals)
+	if err != nil {
+		return nil, fmt.Errorf("compile error: %w", err)
+	}
+	if debugPrintCode {
+		fmt.Println(cover("code", 12, "="))
+		fmt.Println(disassemble(code))
 	}
-	return
+	if debugPrintAST || debugPrintCode {
+		fmt.Println(cover("runtime", 12, "="))
+	}
+	return code, nil
 }
 
 func (e *Evaluator) Call(callee Callable, args []Value) (vals []Value, err error) {
 	if callee == nil {
 		return nil, errors.New("callee is nil")
 	}
-	defer catch(func(exc runtimeException) { err = exc })
+	e.resetLimits()
+	e.epoch++
+	defer catch(e.catchLimit(&err))
+	defer catch(e.catchException(&err))
 
 	return callee.call(e, args), nil
 }
 
-func (e *Evaluator) evalOne(node astNode) Value {
-	return e.eval(node)[0]
-}
-
-func (e *Evaluator) eval(node astNode) []Value {
-	switch node := node.(type) {
-	case *noneLit:
-		return one(None{})
-	case *boolLit:
-		return one(Bool(node.value))
-	case *numLit:
-		return one(Num(node.value))
-	case *strLit:
-		return one(Str(node.value))
-	case *defStmt:
-		e.env.store[node.name] = &Func{
-			Name:    node.name,
-			Params:  node.params,
-			Code:    node.body,
-			Closure: e.env,
+// catchException reports an exception escaping to the host as err
+// and drops the frames it left behind.
+func (e *Evaluator) catchException(err *error) func(exc *RuntimeException) {
+	frames, sp, handlers := len(e.frames), len(e.stack), len(e.handlers)
+	return func(exc *RuntimeException) {
+		if exc.Trace == nil {
+			exc.File, exc.Trace = e.traceback()
 		}
-		return nil
-	case *lambdaLit:
-		return one(&Func{
-			Name:    node.name,
-			Params:  node.params,
-			Code:    node.body,
-			Closure: e.env,
-		})
-	case *decoStmt:
-		deco, ok := e.evalOne(node.deco).(Callable)
-		if !ok {
-			Raise(Str("decorator must be function"))
+		e.frames = e.frames[:frames]
+		e.stack = e.stack[:sp]
+		e.handlers = e.handlers[:handlers]
+		*err = exc
+		if v, ok := exc.Value.(*Error); ok {
+			if limit, ok := errorLimits[v.Name]; ok {
+				*err = &LimitError{limit, exc}
+			}
 		}
-		def := &Func{
-			Name:    node.def.name,
-			Params:  node.def.params,
-			Code:    node.def.body,
-			Closure: e.env,
+	}
+}
+
+func (e *Evaluator) catchLimit(err *error) func(le *LimitError) {
+	frames, sp, handlers := len(e.frames), len(e.stack), len(e.handlers)
+	return func(le *LimitError) {
+		e.frames = e.frames[:frames]
+		e.stack = e.stack[:sp]
+		e.handlers = e.handlers[:handlers]
+		*err = le
+	}
+}
+
+// resetLimits starts a new step budget unless a script is already running.
+func (e *Evaluator) resetLimits() {
+	if len(e.frames) == 0 {
+		e.steps = 0
+		e.tick = 0
+		e.slice = 0
+		e.memory = 0
+		e.memoryOut = false
+	}
+}
+
+// checkLimits is called every few steps to stop scripts which run
+// out of steps or whose context is done.
+func (e *Evaluator) checkLimits() {
+	e.steps += e.slice
+	if e.Context != nil {
+		select {
+		case <-e.Context.Done():
+			panic(&LimitError{LimitContext, e.Context.Err()})
+		default:
 		}
-		decored := deco.call(e, one(def))[0]
-		e.env.store[node.def.name] = decored
-		return nil
-	case *dictLit:
-		doc := &Doc{
-			Pairs: make(map[Value]Value, len(node.pairs)),
-			Proto: nil,
-		}
-		for key, val := range node.pairs {
-			v := e.evalOne(val)
-			k := e.evalOne(key)
-			if _, none := k.(None); none {
-				continue
-			}
-			doc.Pairs[k] = v
+	}
+	e.slice = checkInterval
+	if e.MaxSteps > 0 {
+		left := e.MaxSteps - e.steps
+		if left <= 0 {
+			panic(&LimitError{LimitSteps, nil})
 		}
-		return one(doc)
-	case *protoDictExpr:
-		proto, ok := e.evalOne(node.proto).(Prototype)
-		if !ok {
-			Raise(Str("wrong prototype type"))
+		e.slice = min(e.slice, left)
+	}
+	e.tick = e.slice
+}
+
+// alloc accounts bytes allocated by the script. An allocation over the
+// budget isn't accounted and raises MemoryError, which the script can
+// catch to clean up; going over the budget again stops the script.
+func (e *Evaluator) alloc(bytes int) {
+	if e.MaxMemory <= 0 {
+		return
+	}
+	if e.memory+bytes <= e.MaxMemory {
+		e.memory += bytes
+		return
+	}
+	if e.memoryOut {
+		panic(&LimitError{LimitMemory, nil})
+	}
+	e.memoryOut = true
+	Raise(newError("MemoryError", "memory limit exceeded"))
+}
+
+func (e *Evaluator) checkDepth() {
+	if e.MaxDepth > 0 && len(e.frames) >= e.MaxDepth {
+		Raise(newError("RecursionError", "maximum call depth exceeded"))
+	}
+}
+
+func (e *Evaluator) traceback() (file string, trace []TraceFrame) {
+	trace = make([]TraceFrame, 0, len(e.frames))
+	for _, fr := range e.frames {
+		if fr.native != nil {
+			trace = append(trace, TraceFrame{Func: fr.native.Name})
+			continue
 		}
-		doc := &Doc{
-			Pairs: make(map[Value]Value, len(node.dict.pairs)),
-			Proto: &proto,
+		code := fr.fn.Code
+		pos := code.position(fr.ip - 1)
+		trace = append(trace, TraceFrame{fr.fn.Name, code.file, pos.line, pos.col})
+		file = code.file
+	}
+	return file, trace
+}
+
+func (e *Evaluator) push(val Value) {
+	e.stack = append(e.stack, val)
+}
+
+func (e *Evaluator) pop() Value {
+	val := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return val
+}
+
+func (e *Evaluator) peek() Value {
+	return e.stack[len(e.stack)-1]
+}
+
+// run executes frames until the frame at index stopAt returns
+// and gives back its results.
+func (e *Evaluator) run(stopAt int) (ret []Value) {
+	for {
+		done := true
+		func() {
+			defer catch(func(exc *RuntimeException) {
+				if !e.handle(exc, stopAt) {
+					panic(exc)
+				}
+				done = false
+			})
+
+			ret = e.execute(stopAt)
+		}()
+		if done {
+			return ret
 		}
-		for key, val := range node.dict.pairs {
-			v := e.evalOne(val)
-			k := e.evalOne(key)
-			if _, none := k.(None); none {
-				continue
-			}
-			doc.Pairs[k] = v
+	}
+}
+
+// handle jumps to the innermost exception handler owned by this run,
+// or unwinds all of its frames when there is none.
+func (e *Evaluator) handle(exc *RuntimeException, stopAt int) bool {
+	if n := len(e.handlers); n > 0 && e.handlers[n-1].frames > stopAt {
+		h := e.handlers[n-1]
+		e.handlers = e.handlers[:n-1]
+		if h.finally && exc.Trace == nil {
+			exc.File, exc.Trace = e.traceback()
 		}
-		return one(doc)
-	case *listLit:
-		doc := &Doc{
-			Pairs: make(map[Value]Value, len(node.elems)),
-			Proto: &protoArray,
+		e.frames = e.frames[:h.frames]
+		e.stack = e.stack[:h.sp]
+		if h.finally {
+			e.push(&pendingException{exc})
+		} else {
+			e.push(exc.Value)
 		}
-		for key, val := range node.elems {
-			doc.Pairs[Num(key)] = e.evalOne(val) // maybe many?
+		e.frames[h.frames-1].ip = h.ip
+		return true
+	}
+	if exc.Trace == nil {
+		exc.File, exc.Trace = e.traceback()
+	}
+	fr := e.frames[stopAt]
+	e.frames = e.frames[:stopAt]
+	e.stack = e.stack[:fr.base]
+	e.handlers = e.handlers[:fr.handlers]
+	return false
+}
+
+func (e *Evaluator) execute(stopAt int) []Value {
+	fr := e.frames[len(e.frames)-1]
+	code := fr.fn.Code
+	for {
+		if e.tick--; e.tick < 0 {
+			e.checkLimits()
 		}
-		return one(doc)
-	case *infixExpr:
-		return one(e.infixExpr(node))
-	case *whileStmt:
-		e.whileStmt(node)
-		return nil
-	case *tryStmt:
-		e.tryStmt(node)
-		return nil
-	case *exprStmt:
-		e.eval(node.expr)
-		return nil
-	case *raiseStmt:
-		Raise(e.evalOne(node.exc))
-		return nil
-	case *assignStmt:
-		rightVals := []Value{}
-		for i, r := range node.rights {
-			if i != len(node.rights)-1 {
-				rightVals = append(rightVals, e.evalOne(r))
+		op := opCode(code.code[fr.ip])
+		fr.ip++
+		switch op {
+		case opConst:
+			e.push(code.constants[fr.readShort()])
+		case opNone:
+			e.push(None{})
+		case opTrue:
+			e.push(Bool(true))
+		case opFalse:
+			e.push(Bool(false))
+		case opPop:
+			e.stack = e.stack[:len(e.stack)-1]
+		case opDup:
+			n := fr.readByte()
+			e.stack = append(e.stack, e.stack[len(e.stack)-n:]...)
+		case opReverse:
+			vals := e.stack[len(e.stack)-fr.readByte():]
+			for i, j := 0, len(vals)-1; i < j; i, j = i+1, j-1 {
+				vals[i], vals[j] = vals[j], vals[i]
+			}
+		case opAdjustSpread:
+			n := fr.readByte() + e.nvals
+			want := fr.readByte()
+			for ; n < want; n++ {
+				e.push(None{})
+			}
+			e.stack = e.stack[:len(e.stack)-(n-want)]
+
+		case opGetLocal:
+			e.push(getSlot(fr.env, fr.readShort()))
+		case opSetLocal:
+			fr.env.slots[fr.readShort()] = e.pop()
+		case opGetOuter:
+			en := fr.env.outer(fr.readByte())
+			e.push(getSlot(en, fr.readShort()))
+		case opSetOuter:
+			en := fr.env.outer(fr.readByte())
+			en.slots[fr.readShort()] = e.pop()
+		case opGetGlobal:
+			slot := fr.readShort()
+			g := e.globalSlots(code.globals)
+			if g.vals[slot] == nil {
+				g.vals[slot] = e.getGlobal(fr.fn.module, g.names[slot])
+			}
+			e.push(g.vals[slot])
+		case opSetGlobal:
+			slot := fr.readShort()
+			g := e.globalSlots(code.globals)
+			val := e.pop()
+			if module := fr.fn.module; module != nil {
+				module.Set(g.names[slot], val)
+				if isNone(val) {
+					val = nil // deleted, Globals are looked up again
+				}
 			} else {
-				rightVals = append(rightVals, e.eval(r)...)
+				e.Globals[varName(g.names[slot])] = val
 			}
-		}
-		if len(node.lefts) > len(rightVals) {
-			for range len(node.lefts) - len(rightVals) {
-				rightVals = append(rightVals, None{})
+			// caches of other programs might hold the old value
+			e.epoch++
+			g.epoch = e.epoch
+			g.vals[slot] = val
+
+		case opFunc:
+			fc := code.constants[fr.readShort()].(*funcCode)
+			e.push(&Func{Code: fc, Closure: fr.env, Name: fc.name, module: fr.fn.module})
+		case opList:
+			n := fr.readShort()
+			e.alloc(n * valueSize)
+			arr := &Array{Elems: slices.Clone(e.stack[len(e.stack)-n:])}
+			e.stack = e.stack[:len(e.stack)-n]
+			e.push(arr)
+		case opTuple:
+			n := fr.readShort()
+			e.alloc(n * valueSize)
+			t := &Tuple{Elems: slices.Clone(e.stack[len(e.stack)-n:])}
+			e.stack = e.stack[:len(e.stack)-n]
+			e.push(t)
+		case opDict:
+			n := fr.readShort()
+			doc := newDoc(n, nil)
+			e.popPairs(doc, n)
+			e.push(doc)
+		case opProtoDict:
+			n := fr.readShort()
+			proto, ok := e.stack[len(e.stack)-2*n-1].(Prototype)
+			if !ok {
+				Raise(Str("wrong prototype type"))
 			}
-		}
-		for i, l := range node.lefts {
-			e.assign(l, rightVals[i])
-		}
-		return nil
-	case *declStmt:
-		for _, name := range node.vars {
-			e.types[name] = node.varType
-		}
-		return nil
-	case *ident:
-		return one(e.resolveVariable(node))
-	case *callExpr:
-		left, ok := e.evalOne(node.left).(Callable)
-		if !ok {
-			Raise(Str("call not collable"))
-		}
-		args := e.evalExprs(node.args)
-		return left.call(e, args)
-	case *returnStmt:
-		panic(returnSignal(e.evalExprs(node.values)))
-	case *ifStmt:
-		if valueToBool(e.evalOne(node.cond)) {
-			for _, stmt := range node.then {
-				e.eval(stmt)
+			doc := newDoc(n, &proto)
+			e.popPairs(doc, n)
+			e.stack[len(e.stack)-1] = doc
+		case opIndex:
+			index := e.pop()
+			e.stack[len(e.stack)-1] = e.index(e.peek(), index)
+		case opSetIndex:
+			index := e.pop()
+			left := e.pop()
+			e.setIndex(left, index, e.pop())
+		case opItem:
+			index := e.pop()
+			if m := protoMethod(e.peek(), "__index__"); m != nil {
+				e.stack[len(e.stack)-1] = first(m.call(e, one(index)))
+			} else {
+				e.stack[len(e.stack)-1] = e.index(e.peek(), index)
 			}
-		} else {
-			for _, stmt := range node.else_ {
-				e.eval(stmt)
+		case opSetItem:
+			index := e.pop()
+			left := e.pop()
+			val := e.pop()
+			if m := protoMethod(left, "__setindex__"); m != nil {
+				m.call(e, []Value{index, val})
+			} else {
+				e.setIndex(left, index, val)
+			}
+		case opSlice:
+			step, stop, start := e.pop(), e.pop(), e.pop()
+			e.stack[len(e.stack)-1] = e.getSlice(e.peek(), start, stop, step)
+		case opSetSlice:
+			step, stop, start := e.pop(), e.pop(), e.pop()
+			left := e.pop()
+			e.setSlice(left, start, stop, step, e.pop())
+		case opArrow:
+			index := e.pop()
+			from, ok := e.peek().(Prototype)
+			if !ok {
+				Raise(Str("can't get index"))
+			}
+			var v Value = None{}
+			if from.Prototype() != nil {
+				v = (*from.Prototype()).Index(index)
+			}
+			if _, ok := from.(*Doc); ok && isNone(v) {
+				v = protoDoc.Index(index)
 			}
-		}
-		return nil
-	case *indexExpr:
-		index := e.evalOne(node.index)
-		from, ok := e.evalOne(node.left).(Prototype)
-		if !ok {
-			Raise(Str("can't get index"))
-		}
-		return one(from.Index(index))
-	case *arrowExpr:
-		index := e.evalOne(node.index)
-		from, ok := e.evalOne(node.left).(Prototype)
-		if !ok {
-			Raise(Str("can't get index"))
-		}
-		if from.Prototype() != nil {
-			v := (*from.Prototype()).Index(index)
 			if f, ok := v.(Callable); ok {
 				v = &Method{from.(Value), f}
 			}
-			return one(v)
-		}
-		return one(None{})
-	case *prefixExpr:
-		r := e.evalOne(node.right)
-		switch node.opToken.tokenType {
-		case tokenMinus:
-			rn, ok := r.(Num)
+			e.stack[len(e.stack)-1] = v
+
+		case opNeg:
+			if m := protoMethod(e.peek(), "__neg__"); m != nil {
+				e.stack[len(e.stack)-1] = first(m.call(e, nil))
+				break
+			}
+			v, ok := negate(e.peek())
 			if !ok {
 				Raise(Str("???"))
 			}
-			return one(-rn)
+			e.stack[len(e.stack)-1] = v
+		case opPos:
+			if m := protoMethod(e.peek(), "__pos__"); m != nil {
+				e.stack[len(e.stack)-1] = first(m.call(e, nil))
+			} else if !isNumber(e.peek()) {
+				Raise(newError("TypeError", "bad operand type for unary +: %s", typeName(e.peek())))
+			}
+		case opInvert:
+			if m := protoMethod(e.peek(), "__invert__"); m != nil {
+				e.stack[len(e.stack)-1] = first(m.call(e, nil))
+				break
+			}
+			v, ok := invert(e.peek())
+			if !ok {
+				Raise(newError("TypeError", "bad operand type for unary ~: %s", typeName(e.peek())))
+			}
+			e.stack[len(e.stack)-1] = v
+		case opNot:
+			e.stack[len(e.stack)-1] = !e.truthy(e.peek())
+		case opEqual:
+			b := e.pop()
+			e.stack[len(e.stack)-1] = Bool(e.equal(e.peek(), b))
+		case opNotEqual:
+			b := e.pop()
+			e.stack[len(e.stack)-1] = Bool(!e.equal(e.peek(), b))
+		case opIn:
+			container := e.pop()
+			e.stack[len(e.stack)-1] = Bool(e.contains(container, e.peek()))
+		case opIs:
+			b := e.pop()
+			e.stack[len(e.stack)-1] = Bool(e.peek() == b)
+		case opAdd, opSub, opMul, opDiv, opMod, opPow, opFloorDiv,
+			opLess, opLessEqual, opGreater, opGreaterEqual,
+			opBitAnd, opBitOr, opBitXor, opShiftLeft, opShiftRight:
+			b := e.pop()
+			if v, ok := fastOperation(e.peek(), b, op); ok {
+				e.stack[len(e.stack)-1] = v
+			} else if v, ok := e.metaOperation(e.peek(), b, op); ok {
+				e.stack[len(e.stack)-1] = v
+			} else if op == opAdd {
+				e.stack[len(e.stack)-1] = e.operation(e.peek(), b, tokenPlus)
+			} else {
+				e.stack[len(e.stack)-1] = e.numberOperation(e.peek(), b, binaryTokens[op])
+			}
+		case opFormat:
+			conv := byte(fr.readByte())
+			spec := code.constants[fr.readShort()].(Str)
+			e.stack[len(e.stack)-1] = Str(e.format(e.peek(), conv, string(spec)))
+		case opConcat:
+			n := fr.readShort()
+			var res strings.Builder
+			for _, v := range e.stack[len(e.stack)-n:] {
+				res.WriteString(string(v.(Str)))
+			}
+			e.alloc(res.Len())
+			e.stack = e.stack[:len(e.stack)-n]
+			e.push(Str(res.String()))
+
+		case opAppend:
+			val := e.pop()
+			arr := e.stack[len(e.stack)-1-fr.readByte()].(*Array)
+			e.alloc(valueSize)
+			arr.Elems = append(arr.Elems, val)
+		case opAddPair:
+			doc := e.stack[len(e.stack)-3-fr.readByte()].(*Doc)
+			e.popPairs(doc, 1)
+		case opGenerator:
+			arg := e.pop()
+			e.stack[len(e.stack)-1] = e.newGenerator(e.peek().(*Func), arg)
+		case opYield:
+			val := e.pop()
+			fr.gen.frame = fr
+			fr.gen.stack = append(fr.gen.stack[:0], e.stack[fr.base:]...)
+			e.stack = e.stack[:fr.base]
+			e.frames = e.frames[:len(e.frames)-1]
+			return one(val)
+
+		case opJump:
+			offset := fr.readShort()
+			fr.ip += offset
+		case opLoop:
+			offset := fr.readShort()
+			fr.ip -= offset
+		case opJumpIfFalse:
+			offset := fr.readShort()
+			if !e.truthy(e.pop()) {
+				fr.ip += offset
+			}
+		case opJumpIfFalseOrPop:
+			offset := fr.readShort()
+			if !e.truthy(e.peek()) {
+				fr.ip += offset
+			} else {
+				e.pop()
+			}
+		case opJumpIfTrueOrPop:
+			offset := fr.readShort()
+			if e.truthy(e.peek()) {
+				fr.ip += offset
+			} else {
+				e.pop()
+			}
+		case opJumpIfNone:
+			offset := fr.readShort()
+			if isNone(e.peek()) {
+				fr.ip += offset
+			}
+		case opJumpIfNotNoneOrPop:
+			offset := fr.readShort()
+			if !isNone(e.peek()) {
+				fr.ip += offset
+			} else {
+				e.pop()
+			}
+		case opIter:
+			e.stack[len(e.stack)-1] = &iterValue{e.iterate(e.peek())}
+		case opForIter:
+			n := fr.readByte()
+			offset := fr.readShort()
+			vals, ok := e.peek().(*iterValue).next()
+			if !ok {
+				fr.ip += offset
+				break
+			}
+			if n > 1 && len(vals) == 1 {
+				vals = unpack(vals[0], n)
+			}
+			for i := n - 1; i >= 0; i-- {
+				if i < len(vals) {
+					e.push(vals[i])
+				} else {
+					e.push(None{})
+				}
+			}
+
+		case opCall, opCallSpread:
+			argc := fr.readByte()
+			if op == opCallSpread {
+				argc += e.nvals
+			}
+			e.callValue(argc, fr.readByte())
+			fr = e.frames[len(e.frames)-1]
+			code = fr.fn.Code
+		case opReturn, opReturnSpread:
+			n := fr.readByte()
+			if op == opReturnSpread {
+				n += e.nvals
+			}
+			vals := e.stack[len(e.stack)-n:]
+			e.frames = e.frames[:len(e.frames)-1]
+			e.handlers = e.handlers[:fr.handlers]
+			if len(e.frames) == stopAt {
+				ret := append([]Value(nil), vals...)
+				e.stack = e.stack[:fr.base]
+				return ret
+			}
+			e.stack = e.stack[:fr.base]
+			e.pushResults(vals, fr.want)
+			fr = e.frames[len(e.frames)-1]
+			code = fr.fn.Code
+
+		case opSetupTry, opSetupFinally:
+			offset := fr.readShort()
+			e.handlers = append(e.handlers, handler{
+				frames:  len(e.frames),
+				sp:      len(e.stack),
+				ip:      fr.ip + offset,
+				finally: op == opSetupFinally,
+			})
+		case opPopTry:
+			e.handlers = e.handlers[:len(e.handlers)-1]
+		case opRaise:
+			Raise(e.pop())
+		case opReraise:
+			panic(e.pop().(*pendingException).exc)
+
+		case opImport:
+			name := code.constants[fr.readShort()].(Str)
+			e.push(e.importModule(string(name), code.file))
+		case opImportName:
+			name := code.constants[fr.readShort()].(Str)
+			module := e.peek().(*Doc)
+			v, ok := module.pairs[name]
+			if !ok {
+				Raise(newError("ImportError", "can't import name '%s'", name))
+			}
+			e.push(v)
 		default:
-			panic("eval prefix expr: unknown prefix")
+			panic("execute: unknown op code")
 		}
 	}
-	panic("eval: unknown node type")
 }
 
-func (e *Evaluator) infixExpr(node *infixExpr) Value {
-	var l, r Value
+// globalSlots gives the globals of a program with the values they
+// cached cleared when globals might have changed since.
+func (e *Evaluator) globalSlots(g *globalSlots) *globalSlots {
+	if g.owner != e || g.epoch != e.epoch {
+		clear(g.vals)
+		g.owner = e
+		g.epoch = e.epoch
+	}
+	return g
+}
 
-	l = e.evalOne(node.left)
-	switch node.opToken.tokenType {
-	case tokenAnd:
-		if valueToBool(l) {
-			return e.evalOne(node.right)
-		} else {
-			return l
+// getGlobal looks a global up in the module, then in Globals
+// shared by all modules.
+func (e *Evaluator) getGlobal(module *Doc, name Str) Value {
+	if module != nil {
+		if v, ok := module.pairs[name]; ok {
+			return v
 		}
-	case tokenOr:
-		if valueToBool(l) {
-			return l
-		} else {
-			return e.evalOne(node.right)
-		}
-	}
-
-	r = e.evalOne(node.right)
-	switch node.opToken.tokenType {
-	case tokenEqualEqual:
-		return valuesEqual(l, r)
-	case tokenBangEqual:
-		return !valuesEqual(l, r)
-	case tokenLess, tokenLessEqual, tokenGreater, tokenGreaterEqual,
-		tokenMinus, tokenStar, tokenSlash, tokenPersent,
-		tokenStarStar, tokenSlashSlash:
-		return numberOperation(l, r, node.opToken.tokenType)
-	case tokenPlus:
-		return operation(l, r, node.opToken.tokenType)
-	default:
-		panic("eval infix expr: unknown operation")
 	}
+	v, ok := e.Globals[varName(name)]
+	if !ok {
+		Raise(Str("undefined variable"))
+	}
+	return v
 }
 
-func (e *Evaluator) whileStmt(node *whileStmt) {
-	defer catch(func(sig breakSignal) {})
-
-	loop := func() {
-		defer catch(func(sig continueSignal) {})
-
-		for _, stmt := range node.loop {
-			e.eval(stmt)
+func (e *Evaluator) popPairs(doc *Doc, n int) {
+	e.alloc(n * pairSize)
+	pairs := e.stack[len(e.stack)-2*n:]
+	for i := 0; i < len(pairs); i += 2 {
+		if _, none := pairs[i].(None); none {
+			continue
 		}
+		doc.set(e, pairs[i], pairs[i+1])
 	}
+	e.stack = e.stack[:len(e.stack)-2*n]
+}
 
-	for valueToBool(e.evalOne(node.cond)) {
-		loop()
+// callValue calls the value below the top argc arguments and leaves
+// want results in its place, or enters a new frame for a Func.
+func (e *Evaluator) callValue(argc, want int) {
+	at := len(e.stack) - argc - 1
+	for {
+		switch callee := e.stack[at].(type) {
+		case *Func:
+			e.callFunc(callee, argc, want)
+			return
+		case *Method:
+			e.stack = append(e.stack, nil)
+			copy(e.stack[at+2:], e.stack[at+1:])
+			e.stack[at] = callee.method
+			e.stack[at+1] = callee.self
+			argc++
+		case *NativeFunc:
+			args := make([]Value, argc)
+			copy(args, e.stack[at+1:])
+			e.stack = e.stack[:at]
+			e.pushResults(callee.call(e, args), want)
+			return
+		default:
+			if m := protoMethod(callee, "__call__"); m != nil {
+				e.stack[at] = m
+				continue
+			}
+			Raise(Str("call not collable"))
+		}
 	}
 }
 
-func (e *Evaluator) tryStmt(node *tryStmt) {
-	var exc Value
-	func() {
-		defer catch(func(sig runtimeException) { exc = sig.value })
-
-		for _, stmt := range node.try {
-			e.eval(stmt)
+func (e *Evaluator) callFunc(f *Func, argc, want int) {
+	e.checkDepth()
+	e.alloc(frameSize + f.Code.locals*valueSize)
+	base := len(e.stack) - argc - 1
+	env := newEnv(f.Closure, f.Code.locals)
+	for i := range f.Code.params {
+		if i < argc {
+			env.slots[i] = e.stack[base+1+i]
+		} else {
+			env.slots[i] = None{}
 		}
-	}()
-
-	var reRaise Value
-	func() {
-		defer catch(func(sig runtimeException) { reRaise = sig.value })
+	}
+	e.stack = e.stack[:base]
+	e.frames = append(e.frames, &frame{
+		fn:       f,
+		base:     base,
+		want:     want,
+		handlers: len(e.handlers),
+		env:      env,
+	})
+}
 
-		if exc != nil {
-			e.env.store[node.as] = exc
-			for _, stmt := range node.except {
-				e.eval(stmt)
-			}
+func (e *Evaluator) pushResults(vals []Value, want int) {
+	if want == wantAll {
+		e.stack = append(e.stack, vals...)
+		e.nvals = len(vals)
+		return
+	}
+	for i := range want {
+		if i < len(vals) {
+			e.push(vals[i])
+		} else {
+			e.push(None{})
 		}
-	}()
+	}
+}
+
+func getSlot(en *env, slot int) Value {
+	v := en.slots[slot]
+	if v == nil {
+		Raise(Str("undefined variable"))
+	}
+	return v
+}
 
-	for _, stmt := range node.finally {
-		e.eval(stmt)
+func (e *Evaluator) index(from, index Value) Value {
+	switch from := from.(type) {
+	case *Doc:
+		return from.get(e, index)
+	case Prototype:
+		return from.Index(index)
 	}
+	Raise(Str("can't get index"))
+	return nil
+}
 
-	if reRaise != nil {
-		Raise(reRaise)
+func (e *Evaluator) setIndex(left, index, val Value) {
+	switch left := left.(type) {
+	case *Doc:
+		left.checkFrozen()
+		if _, del := val.(None); del {
+			left.delete(e, index)
+			return
+		}
+		if _, ok := left.pairs[left.key(e, index)]; !ok {
+			e.alloc(pairSize)
+		}
+		left.set(e, index, val)
+	case *Array:
+		if !isNumber(index) {
+			Raise(newError("TypeError", "list indices must be numbers, not %s", typeName(index)))
+		}
+		if i, ok := toIndex(index); ok && i == len(left.Elems) {
+			e.alloc(valueSize)
+			left.Elems = append(left.Elems, val)
+			return
+		}
+		left.Elems[left.index(index)] = val
+	case *Tuple:
+		Raise(newError("TypeError", "tuple doesn't support item assignment"))
+	case *Box:
+		left.Setter(index, val)
+	default:
+		Raise(Str("TODO"))
 	}
 }
 
-func (e *Evaluator) evalExprs(exprs []astExpr) []Value {
-	ret := []Value{}
-	for i, arg := range exprs {
-		if i != len(exprs)-1 {
-			ret = append(ret, e.evalOne(arg))
-		} else {
-			ret = append(ret, e.eval(arg)...)
+// contains tells whether v is in a container: a key of a doc, a part of
+// a string or an element of anything else iterable. Values with
+// '__contains__' answer themselves.
+func (e *Evaluator) contains(container, v Value) bool {
+	if m := protoMethod(container, "__contains__"); m != nil {
+		return bool(e.truthy(first(m.call(e, one(v)))))
+	}
+	switch c := container.(type) {
+	case Str:
+		s, ok := v.(Str)
+		if !ok {
+			Raise(newError("TypeError", "'in <Str>' needs a Str, not %s", typeName(v)))
 		}
+		return strings.Contains(string(c), string(s))
+	case *Doc:
+		_, ok := c.pairs[c.key(e, v)]
+		return ok
+	case *Array:
+		return indexOf(e, c.Elems, v) >= 0
+	case *Tuple:
+		return indexOf(e, c.Elems, v) >= 0
 	}
-	return ret
+	next := e.iterate(container)
+	for {
+		vals, ok := next()
+		if !ok {
+			return false
+		}
+		if e.equal(first(vals), v) {
+			return true
+		}
+	}
+}
+
+// unpack gives the elements of a list or a tuple iterated by a loop
+// with n variables.
+func unpack(val Value, n int) []Value {
+	var elems []Value
+	switch val := val.(type) {
+	case *Array:
+		elems = val.Elems
+	case *Tuple:
+		elems = val.Elems
+	default:
+		Raise(newError("TypeError", "can't unpack %s into %d variables", typeName(val), n))
+	}
+	if len(elems) != n {
+		Raise(newError("ValueError", "expected %d values to unpack, got %d", n, len(elems)))
+	}
+	return elems
 }
 
-func (e *Evaluator) resolveVariable(ident *ident) Value {
-	if t, ok := e.env.types[ident.name]; ok {
-		switch t {
-		case varLocal:
-			if v, ok := e.env.store[ident.name]; ok {
-				return v
+func (e *Evaluator) iterate(val Value) Iterator {
+	if next := e.protoIterator(val); next != nil {
+		return next
+	}
+	switch val := val.(type) {
+	case Str:
+		runes := []rune(val)
+		i := 0
+		return func() ([]Value, bool) {
+			if i >= len(runes) {
+				return nil, false
 			}
-		case varNonLocal:
-			env := e.env.encl
-			for env != nil {
-				if v, ok := env.store[ident.name]; ok {
-					return v
-				}
-				env = env.encl
+			i++
+			e.alloc(utf8.RuneLen(runes[i-1]))
+			return one(Str(runes[i-1])), true
+		}
+	case *Array:
+		i := 0
+		return func() ([]Value, bool) {
+			if i >= len(val.Elems) {
+				return nil, false
 			}
-		case varGlobal:
-			if v, ok := e.Globals[ident.name]; ok {
-				return v
+			i++
+			return one(val.Elems[i-1]), true
+		}
+	case *Tuple:
+		i := 0
+		return func() ([]Value, bool) {
+			if i >= len(val.Elems) {
+				return nil, false
 			}
+			i++
+			return one(val.Elems[i-1]), true
+		}
+	case *Doc:
+		keys := val.Keys()
+		i := 0
+		return func() ([]Value, bool) {
+			for i < len(keys) {
+				k := keys[i]
+				i++
+				if v, ok := val.pairs[k]; ok {
+					return []Value{k, v}, true
+				}
+			}
+			return nil, false
+		}
+	case *Generator:
+		return func() ([]Value, bool) { return e.resume(val) }
+	case *Box:
+		if val.Iter != nil {
+			return val.Iter()
 		}
-		Raise(Str("undefined variable"))
 	}
+	Raise(newError("TypeError", "%s is not iterable", typeName(val)))
+	return nil
+}
 
-	env := e.env
-	for env != nil {
-		if v, ok := env.store[ident.name]; ok {
-			return v
+// protoIterator supports user-defined iterators: '__iter__' returns the
+// iterator and '__next__' returns the next values, None when exhausted.
+func (e *Evaluator) protoIterator(val Value) Iterator {
+	if iter := protoMethod(val, "__iter__"); iter != nil {
+		it := iter.call(e, nil)[0]
+		if next := protoMethod(it, "__next__"); next != nil {
+			return e.callIterator(next)
+		}
+		if it == val {
+			Raise(Str("'__iter__' must return an iterator"))
 		}
-		env = env.encl
+		return e.iterate(it)
 	}
-	if v, ok := e.Globals[ident.name]; ok {
-		return v
+	if next := protoMethod(val, "__next__"); next != nil {
+		return e.callIterator(next)
 	}
-	Raise(Str("undefined variable"))
 	return nil
 }
 
-func (e *Evaluator) assign(to astExpr, val Value) {
-	switch to := to.(type) {
-	case *ident:
-		e.assignToVariable(to.name, val)
-	case *indexExpr:
-		index := e.evalOne(to.index)
-		left := e.evalOne(to.left)
-		switch left := left.(type) {
-		case *Doc:
-			if _, del := val.(None); del {
-				delete(left.Pairs, index)
-				return
-			}
-			left.Pairs[index] = val
-		case *Box:
-			left.Setter(index, val)
-		default:
-			Raise(Str("TODO"))
+func (e *Evaluator) callIterator(next Callable) Iterator {
+	done := false
+	return func() ([]Value, bool) {
+		if done {
+			return nil, false
 		}
-	default:
-		panic("set: unknown type")
+		vals := next.call(e, nil)
+		if len(vals) == 0 || isNone(vals[0]) {
+			done = true
+			return nil, false
+		}
+		return vals, true
 	}
 }
 
-func (e *Evaluator) assignToVariable(variable varName, val Value) {
-	if t, ok := e.env.types[variable]; ok {
-		switch t {
-		case varLocal:
-			e.env.store[variable] = val
-			return
-		case varNonLocal:
-			env := e.env.encl
-			for env != nil {
-				if _, ok := env.store[variable]; ok {
-					env.store[variable] = val
-					return
-				}
-				env = env.encl
-			}
-		case varGlobal:
-			e.Globals[variable] = val
-			return
-		}
-		Raise(Str("undefined variable"))
+func protoMethod(val Value, name string) Callable {
+	p, ok := val.(Prototype)
+	if !ok || p.Prototype() == nil {
+		return nil
 	}
-
-	e.env.store[variable] = val
+	f, ok := (*p.Prototype()).Index(Str(name)).(Callable)
+	if !ok {
+		return nil
+	}
+	return &Method{val, f}
 }
 
 func valueToBool(val Value) Bool {
@@ -445,65 +1065,69 @@ func valueToBool(val Value) Bool {
 	return true
 }
 
-func valuesEqual(a, b Value) Bool { return a == b }
-
-func numberOperation(a, b Value, op tokenType) Value {
-	an, ok1 := a.(Num)
-	bn, ok2 := b.(Num)
-	if !ok1 || !ok2 {
-		Raise(Str("operands must be numbers"))
-	}
-	switch op {
-	case tokenPlus:
-		return an + bn
-	case tokenMinus:
-		return an - bn
-	case tokenStar:
-		return an * bn
-	case tokenSlash:
-		return an / bn
-	case tokenPersent:
-		r := (an / bn)
-		return an - bn*Num(int(r))
-	case tokenStarStar:
-		return Num(math.Pow(float64(an), float64(bn)))
-	case tokenSlashSlash:
-		return Num(math.Floor(float64(an / bn)))
-	case tokenLess:
-		return Bool(an < bn)
-	case tokenLessEqual:
-		return Bool(an <= bn)
-	case tokenGreater:
-		return Bool(an > bn)
-	case tokenGreaterEqual:
-		return Bool(an >= bn)
-	}
-	panic("number operation: unknown operation")
-}
-
-func operation(a, b Value, op tokenType) Value {
+func (e *Evaluator) operation(a, b Value, op tokenType) Value {
 	if op == tokenPlus {
 		as, ok1 := a.(Str)
 		bs, ok2 := b.(Str)
 		if ok1 && ok2 {
+			e.alloc(len(as) + len(bs))
 			return as + bs
 		}
-		an, ok1 := a.(Num)
-		bn, ok2 := b.(Num)
-		if ok1 && ok2 {
-			return an + bn
+		if isNumber(a) && isNumber(b) {
+			return e.numberOperation(a, b, op)
 		}
 		Raise(Str("operands must be numbers or strings"))
 	}
 	panic("operation: unknown operation")
 }
 
-func (exc runtimeException) Error() string {
-	return fmt.Sprint(exc.value)
+func (exc *RuntimeException) Error() string {
+	return fmt.Sprint(exc.Value)
+}
+
+func (le *LimitError) Error() string {
+	if le.Err != nil {
+		return "execution stopped: " + le.Err.Error()
+	}
+	return fmt.Sprintf("execution stopped: %s limit exceeded", le.Limit)
+}
+
+func (le *LimitError) Unwrap() error { return le.Err }
+
+func (exc *RuntimeException) Traceback() string {
+	var data strings.Builder
+	data.WriteString("Traceback (most recent call last):\n")
+	repeated := 0
+	for i, fr := range exc.Trace {
+		if i > 0 && fr == exc.Trace[i-1] {
+			repeated++
+			if repeated >= tracebackRepeats {
+				continue
+			}
+		} else if repeated >= tracebackRepeats {
+			fmt.Fprintf(&data, "  [Previous line repeated %d more times]\n",
+				repeated-tracebackRepeats+1)
+			repeated = 0
+		} else {
+			repeated = 0
+		}
+		if fr.File == "" {
+			fmt.Fprintf(&data, "  Native %s\n", fr.Func)
+		} else {
+			fmt.Fprintf(&data, "  File \"%s\", line %d:%d, in %s\n",
+				fr.File, fr.Line, fr.Col, fr.Func)
+		}
+	}
+	if repeated >= tracebackRepeats {
+		fmt.Fprintf(&data, "  [Previous line repeated %d more times]\n",
+			repeated-tracebackRepeats+1)
+	}
+	fmt.Fprintf(&data, "Error: %v", exc.Value)
+	return data.String()
 }
 
 func Raise(exception Value) {
-	panic(runtimeException{exception})
+	panic(&RuntimeException{Value: exception})
 }
 
 func one(val Value) []Value { return []Value{val} }
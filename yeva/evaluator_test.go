@@ -0,0 +1,721 @@
+package yeva
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// run interprets source with a new Evaluator and fails on errors.
+func run(t *testing.T, source string) *Evaluator {
+	t.Helper()
+	e := New()
+	if err := e.Interpret([]byte(source)); err != nil {
+		t.Fatalf("Interpret: %v", err)
+	}
+	return e
+}
+
+// global gives a variable of the main script.
+func global(t *testing.T, e *Evaluator, name string) Value {
+	t.Helper()
+	v, ok := e.Globals[name]
+	if !ok {
+		t.Fatalf("global %s is not set", name)
+	}
+	return v
+}
+
+// show formats a value for comparisons, strings are quoted and the
+// pairs of docs are sorted.
+func show(v Value) string {
+	switch v := v.(type) {
+	case Str:
+		return strconv.Quote(string(v))
+	case *Array:
+		elems := make([]string, len(v.Elems))
+		for i, elem := range v.Elems {
+			elems[i] = show(elem)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case *Tuple:
+		elems := make([]string, len(v.Elems))
+		for i, elem := range v.Elems {
+			elems[i] = show(elem)
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	case *Doc:
+		pairs := make([]string, 0, len(v.pairs))
+		for key, val := range v.pairs {
+			pairs = append(pairs, show(key)+": "+show(val))
+		}
+		slices.Sort(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	}
+	return fmt.Sprint(v)
+}
+
+type scriptTest struct {
+	name   string
+	source string
+	want   string // shown value of the global x
+}
+
+func runScriptTests(t *testing.T, tests []scriptTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := run(t, tt.source)
+			if got := show(global(t, e, "x")); got != tt.want {
+				t.Errorf("x = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpret(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"arithmetic", `x = 1 + 2 * 3 - 4 / 2`, "5.0"},
+		{"precedence", `x = (1 + 2) * 3`, "9"},
+		{"strings", `x = "ab" + "cd"`, `"abcd"`},
+		{"comparisons", `x = [1 < 2, 2 <= 1, "a" == "a", 1 != 1]`, "[True, False, True, False]"},
+		{"and or", `x = [None or 2, 1 and 2, False and 1]`, "[2, 2, False]"},
+		{"if", `
+if 1 > 2:
+    x = "a"
+elif 2 > 1:
+    x = "b"
+else:
+    x = "c"
+`, `"b"`},
+		{"while", `
+x = 0
+i = 0
+while i < 10:
+    i = i + 1
+    if i == 3:
+        continue
+    if i == 6:
+        break
+    x = x + i
+`, "12"},
+		{"functions", `
+def add(a, b):
+    return a + b
+x = add(1, 2)
+`, "3"},
+		{"missing arguments", `
+def f(a, b):
+    return b
+x = f(1)
+`, "None"},
+		{"multiple results", `
+def f():
+    return 1, 2
+a, b = f()
+x = [b, a]
+`, "[2, 1]"},
+		{"spread results", `
+def f():
+    return 1, 2
+def g(a, b, c):
+    return [a, b, c]
+x = g(0, f())
+`, "[0, 1, 2]"},
+		{"closures", `
+def counter():
+    n = 0
+    def inc():
+        nonlocal n
+        n = n + 1
+        return n
+    return inc
+c = counter()
+c()
+x = c()
+`, "2"},
+		{"lambda", `
+f = lambda a b: a * b
+x = f(3, 4)
+`, "12"},
+		{"recursion", `
+def fib(n):
+    if n < 2:
+        return n
+    return fib(n - 1) + fib(n - 2)
+x = fib(15)
+`, "610"},
+		{"docs", `
+x = {a: 1}
+x.b = 2
+x["c"] = 3
+x.a = None
+`, `{"b": 2, "c": 3}`},
+		{"prototypes", `
+P = { hello: lambda self: "hi " + self.name }
+x = P{ name: "Yeva" }->hello()
+`, `"hi Yeva"`},
+		{"decorators", `
+def twice(f):
+    return lambda v: f(f(v))
+@twice
+def inc(v):
+    return v + 1
+x = inc(1)
+`, "3"},
+		{"try except", `
+try:
+    raise "boom"
+except as err:
+    x = err
+`, `"boom"`},
+		{"try finally", `
+x = ""
+try:
+    try:
+        raise "boom"
+    finally:
+        x = x + "finally "
+except:
+    x = x + "except"
+`, `"finally except"`},
+		{"nested raise", `
+def f():
+    raise "inner"
+try:
+    f()
+except as err:
+    x = "caught " + err
+`, `"caught inner"`},
+		{"raise in loop", `
+x = 0
+for v in [1, 2, 3]:
+    try:
+        if v == 2:
+            raise v
+        x = x + v
+    except as err:
+        x = x + err * 10
+`, "24"},
+	})
+}
+
+func TestCall(t *testing.T) {
+	e := run(t, `
+def pair(a, b):
+    return b, a
+def fail():
+    raise "boom"
+`)
+	vals, err := e.Call(global(t, e, "pair").(Callable), []Value{Num(1), Str("a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 2 || vals[0] != Str("a") || vals[1] != Num(1) {
+		t.Errorf("Call(pair) = %v", vals)
+	}
+	_, err = e.Call(global(t, e, "fail").(Callable), nil)
+	var exc *RuntimeException
+	if !errors.As(err, &exc) || exc.Value != Str("boom") {
+		t.Errorf("Call(fail) = %v, want boom", err)
+	}
+	if _, err := e.Call(nil, nil); err == nil {
+		t.Error("Call(nil) didn't fail")
+	}
+}
+
+func TestFor(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"list", `
+x = 0
+for v in [1, 2, 3]:
+    x = x + v
+`, "6"},
+		{"string", `
+x = ""
+for c in "héj":
+    x = c + x
+`, `"jéh"`},
+		{"doc", `
+x = {}
+for k, v in {a: 1, b: 2}:
+    x[v] = k
+`, `{1: "a", 2: "b"}`},
+		{"unpacking", `
+x = []
+for a, b in [[1, 2], (3, 4)]:
+    x->push(a * b)
+`, "[2, 12]"},
+		{"one variable over a doc", `
+x = {}
+for k in {a: 1, b: 2}:
+    x[k] = True
+`, `{"a": True, "b": True}`},
+		{"break and continue", `
+x = 0
+for v in [1, 2, 3, 4, 5]:
+    if v == 2:
+        continue
+    if v == 4:
+        break
+    x = x + v
+`, "4"},
+		{"nested break", `
+x = 0
+for a in [1, 2]:
+    for b in [1, 2, 3]:
+        if b == 2:
+            break
+        x = x + a * b
+`, "3"},
+		{"next", `
+Range = {}
+def next(self):
+    if self.i >= self.n:
+        return None
+    self.i = self.i + 1
+    return self.i
+Range.__next__ = next
+x = 0
+for v in Range{ i: 0, n: 3 }:
+    x = x * 10 + v
+`, "123"},
+		{"iter", `
+Counter = {}
+Counter.__iter__ = lambda self: [self.a, self.b]
+x = 0
+for v in Counter{ a: 4, b: 5 }:
+    x = x * 10 + v
+`, "45"},
+	})
+}
+
+func TestForBox(t *testing.T) {
+	e := New()
+	e.Globals["box"] = &Box{Iter: func() Iterator {
+		i := 0
+		return func() ([]Value, bool) {
+			i++
+			return []Value{Int(i)}, i <= 3
+		}
+	}}
+	if err := e.Interpret([]byte("x = 0\nfor v in box:\n    x = x + v\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != "6" {
+		t.Errorf("x = %s, want 6", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"global", `
+def f():
+    global x
+    x = 1
+f()
+`, "1"},
+		{"global read", `
+n = 2
+def f():
+    return n
+n = 3
+x = f()
+`, "3"},
+		{"nonlocal", `
+def f():
+    n = 1
+    def g():
+        nonlocal n
+        n = 2
+    g()
+    return n
+x = f()
+`, "2"},
+		{"local shadows", `
+n = 1
+def f():
+    local n
+    n = 2
+    return n
+x = [f(), n]
+`, "[2, 1]"},
+		{"assignment is local", `
+n = 1
+def f():
+    n = 2
+f()
+x = n
+`, "1"},
+		{"nested nonlocal", `
+def f():
+    n = 0
+    def g():
+        def h():
+            nonlocal n
+            n = n + 5
+        h()
+    g()
+    return n
+x = f()
+`, "5"},
+		{"closures share slots", `
+def f():
+    n = 0
+    def inc():
+        nonlocal n
+        n = n + 1
+    def get():
+        return n
+    inc()
+    inc()
+    return get()
+x = f()
+`, "2"},
+		{"loop variables", `
+def f():
+    s = 0
+    for v in [1, 2, 3]:
+        s = s + v
+    return s + v
+x = f()
+`, "9"},
+	})
+
+	errTests := []struct{ name, source, want string }{
+		{"unresolved nonlocal", "def f():\n    nonlocal y\n    y = 1\n", "no binding for nonlocal 'y'"},
+		{"nonlocal global", "y = 1\ndef f():\n    nonlocal y\n    return y\n", "no binding for nonlocal 'y'"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New().Interpret([]byte(tt.source))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Interpret = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if err := New().Interpret([]byte("def f():\n    return y\nf()\n")); err == nil {
+		t.Error("reading an undefined global didn't fail")
+	}
+}
+
+func TestGlobalsChanged(t *testing.T) {
+	e := New()
+	set, _ := WrapFunc(func(e *Evaluator, name string, v Value) { e.Globals[name] = v })
+	e.Globals["set"] = set
+	err := e.Interpret([]byte(`
+n = 1
+def get():
+    return n
+a = get()
+set("n", 2)
+b = [n, get()]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "b")); got != "[2, 2]" {
+		t.Errorf("after a native set n, b = %s", got)
+	}
+
+	e.Globals["n"] = Int(3)
+	get := global(t, e, "get").(*Func)
+	vals, err := e.Call(get, nil)
+	if err != nil || len(vals) != 1 || vals[0] != Int(3) {
+		t.Errorf("Call(get) = %v, %v after Globals changed", vals, err)
+	}
+	if err := e.Interpret([]byte("n = 4\nx = get()\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != "4" {
+		t.Errorf("get() of an earlier script = %s, want 4", got)
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	e := New()
+	err := e.InterpretFile("main.yeva", []byte(`
+def inner():
+    raise "boom"
+
+def outer():
+    inner()
+
+outer()
+`))
+	var exc *RuntimeException
+	if !errors.As(err, &exc) {
+		t.Fatalf("Interpret = %v, want a RuntimeException", err)
+	}
+	if exc.Value != Str("boom") || exc.File != "main.yeva" {
+		t.Errorf("exception = %v in %s", exc.Value, exc.File)
+	}
+	want := []TraceFrame{
+		{"(main)", "main.yeva", 8, 6},
+		{"outer", "main.yeva", 6, 10},
+		{"inner", "main.yeva", 3, 5},
+	}
+	if !reflect.DeepEqual(exc.Trace, want) {
+		t.Errorf("Trace = %v, want %v", exc.Trace, want)
+	}
+	tb := exc.Traceback()
+	for _, line := range []string{
+		"Traceback (most recent call last):",
+		`File "main.yeva", line 6:10, in outer`,
+		"Error: boom",
+	} {
+		if !strings.Contains(tb, line) {
+			t.Errorf("Traceback() = %q, want %q in it", tb, line)
+		}
+	}
+}
+
+func TestTracebackFinally(t *testing.T) {
+	for _, tt := range []struct {
+		name, source string
+		want         []TraceFrame
+	}{
+		{"through finally", `
+def f():
+    try:
+        raise "boom"
+    finally:
+        x = 1
+
+f()
+`, []TraceFrame{
+			{"(main)", "main.yeva", 8, 2},
+			{"f", "main.yeva", 4, 9},
+		}},
+		{"from a called function", `
+def g():
+    raise "boom"
+
+def f():
+    try:
+        g()
+    finally:
+        x = 1
+
+f()
+`, []TraceFrame{
+			{"(main)", "main.yeva", 11, 2},
+			{"f", "main.yeva", 7, 10},
+			{"g", "main.yeva", 3, 5},
+		}},
+		{"from except", `
+def f():
+    try:
+        raise "a"
+    except:
+        raise "boom"
+    finally:
+        x = 1
+
+f()
+`, []TraceFrame{
+			{"(main)", "main.yeva", 10, 2},
+			{"f", "main.yeva", 6, 9},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New().InterpretFile("main.yeva", []byte(tt.source))
+			var exc *RuntimeException
+			if !errors.As(err, &exc) {
+				t.Fatalf("Interpret = %v, want a RuntimeException", err)
+			}
+			if exc.Value != Str("boom") {
+				t.Errorf("exception = %v, want boom", exc.Value)
+			}
+			if !reflect.DeepEqual(exc.Trace, tt.want) {
+				t.Errorf("Trace = %v, want %v", exc.Trace, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracebackNative(t *testing.T) {
+	e := New()
+	e.Globals["call"] = &NativeFunc{Name: "call", Code: func(e *Evaluator, args []Value) []Value {
+		return args[0].(Callable).call(e, nil)
+	}}
+	err := e.Interpret([]byte("def f():\n    raise \"x\"\ncall(f)\n"))
+	var exc *RuntimeException
+	if !errors.As(err, &exc) {
+		t.Fatalf("Interpret = %v, want a RuntimeException", err)
+	}
+	if len(exc.Trace) != 3 || exc.Trace[1] != (TraceFrame{Func: "call"}) {
+		t.Errorf("Trace = %v", exc.Trace)
+	}
+}
+func TestTracebackRepeats(t *testing.T) {
+	err := New().Interpret([]byte(`
+def f(n):
+    if n == 0:
+        raise "bottom"
+    f(n - 1)
+f(10)
+`))
+	var exc *RuntimeException
+	if !errors.As(err, &exc) {
+		t.Fatalf("Interpret = %v, want a RuntimeException", err)
+	}
+	if len(exc.Trace) != 12 {
+		t.Errorf("len(Trace) = %d, want 12", len(exc.Trace))
+	}
+	if tb := exc.Traceback(); !strings.Contains(tb, "[Previous line repeated 7 more times]") {
+		t.Errorf("Traceback() = %q", tb)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	loop := "while True:\n    x = 1\n"
+	recurse := "def f(n):\n    return f(n + 1)\nf(0)\n"
+	grow := "s = \"x\"\nwhile True:\n    s = s + s\n"
+	fill := "d = {}\ni = 0\nwhile True:\n    d[i] = [i, i]\n    i = i + 1\n"
+	done, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		source string
+		setup  func(e *Evaluator)
+		limit  Limit
+	}{
+		{"steps", loop, func(e *Evaluator) { e.MaxSteps = 10000 }, LimitSteps},
+		{"context", loop, func(e *Evaluator) { e.Context = done }, LimitContext},
+		{"depth", recurse, func(e *Evaluator) { e.MaxDepth = 100 }, LimitDepth},
+		{"default depth", recurse, func(e *Evaluator) {}, LimitDepth},
+		{"memory of strings", grow, func(e *Evaluator) { e.MaxMemory = 1 << 20 }, LimitMemory},
+		{"memory of docs", fill, func(e *Evaluator) { e.MaxMemory = 1 << 20 }, LimitMemory},
+		{"memory of frames", recurse, func(e *Evaluator) { e.MaxMemory = 1 << 16 }, LimitMemory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New()
+			tt.setup(e)
+			err := e.Interpret([]byte(tt.source))
+			var le *LimitError
+			if !errors.As(err, &le) {
+				t.Fatalf("Interpret = %v, want a LimitError", err)
+			}
+			if le.Limit != tt.limit {
+				t.Errorf("Limit = %s, want %s", le.Limit, tt.limit)
+			}
+		})
+	}
+
+	e := New()
+	e.Context = done
+	if err := e.Interpret([]byte(loop)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Interpret = %v, want it to wrap context.Canceled", err)
+	}
+
+	e = New()
+	e.MaxSteps = 10000
+	if err := e.Interpret([]byte(loop)); err == nil {
+		t.Fatal("Interpret didn't stop")
+	}
+	if err := e.Interpret([]byte("x = 1\n")); err != nil {
+		t.Errorf("steps aren't renewed by Interpret: %v", err)
+	}
+}
+
+func TestCatchRecursionError(t *testing.T) {
+	e := New()
+	e.MaxDepth = 50
+	err := e.Interpret([]byte(`
+def f():
+    return f()
+try:
+    f()
+except as err:
+    x = err.name
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != `"RecursionError"` {
+		t.Errorf("caught %s, want RecursionError", got)
+	}
+}
+
+func TestCatchMemoryError(t *testing.T) {
+	e := New()
+	e.MaxMemory = 1 << 16
+	err := e.Interpret([]byte(`
+s = "x"
+try:
+    while True:
+        s = s + s
+except as err:
+    x = err.name
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != `"MemoryError"` {
+		t.Errorf("caught %s, want MemoryError", got)
+	}
+}
+
+func TestNotIterable(t *testing.T) {
+	for _, source := range []string{
+		"for v in println:\n    x = v\n",
+		"for v in lambda: 1:\n    x = v\n",
+		"for v in 5:\n    x = v\n",
+		"x = 1 in None\n",
+	} {
+		err := New().Interpret([]byte(source))
+		var exc *RuntimeException
+		if !errors.As(err, &exc) {
+			t.Errorf("Interpret(%q) = %v, want a TypeError", source, err)
+			continue
+		}
+		if v, ok := exc.Value.(*Error); !ok || v.Name != "TypeError" {
+			t.Errorf("Interpret(%q) raised %v, want a TypeError", source, exc.Value)
+		}
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	e := New()
+	e.MaxMemory = 1 << 16
+	err := e.Interpret([]byte(`
+try:
+    s = "x"->repeat(1 << 20)
+except as err:
+    x = err.name
+small = "a" + "b"
+`))
+	if err != nil {
+		t.Fatalf("allocating after a caught MemoryError: %v", err)
+	}
+	if got := global(t, e, "x"); got != Str("MemoryError") {
+		t.Errorf("caught %v, want MemoryError", got)
+	}
+
+	err = e.Interpret([]byte(`
+s = "x"
+try:
+    while True:
+        s = s + s
+except:
+    caught = True
+while True:
+    s = s + s
+`))
+	var le *LimitError
+	if !errors.As(err, &le) || le.Limit != LimitMemory {
+		t.Errorf("going over the budget again = %v, want a memory LimitError", err)
+	}
+
+	if err := e.Interpret([]byte(`s = "x"->repeat(1000)`)); err != nil {
+		t.Errorf("budget isn't renewed by Interpret: %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package yeva
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// formatSpec is a parsed format spec of an f-string,
+// '[[fill]align][sign][#][0][width][,|_][.precision][type]'.
+type formatSpec struct {
+	fill      rune
+	align     byte // '<', '>', '^', '=' or 0
+	sign      byte // '+', '-', ' ' or 0
+	alt       bool // '#', prefixes '0b', '0o' and '0x'
+	width     int
+	grouping  byte // ',', '_' or 0
+	precision int  // -1 when not given
+	verb      byte // the type, 0 when not given
+}
+
+func parseFormatSpec(spec string) (f formatSpec, ok bool) {
+	f = formatSpec{fill: ' ', precision: -1}
+	s := spec
+	if r, size := utf8.DecodeRuneInString(s); size < len(s) && isAlign(s[size]) {
+		f.fill, f.align, s = r, s[size], s[size+1:]
+	} else if len(s) > 0 && isAlign(s[0]) {
+		f.align, s = s[0], s[1:]
+	}
+	if len(s) > 0 && strings.IndexByte("+- ", s[0]) >= 0 {
+		f.sign, s = s[0], s[1:]
+	}
+	if len(s) > 0 && s[0] == '#' {
+		f.alt, s = true, s[1:]
+	}
+	if len(s) > 0 && s[0] == '0' {
+		if f.align == 0 {
+			f.fill, f.align = '0', '='
+		}
+		s = s[1:]
+	}
+	if f.width, s, ok = leadingInt(s); !ok {
+		return f, false
+	}
+	if len(s) > 0 && (s[0] == ',' || s[0] == '_') {
+		f.grouping, s = s[0], s[1:]
+	}
+	if len(s) > 0 && s[0] == '.' {
+		if f.precision, s, ok = leadingInt(s[1:]); !ok || f.precision < 0 {
+			return f, false
+		}
+	}
+	switch {
+	case len(s) == 1 && strings.IndexByte("sdboxXeEfFgG%", s[0]) >= 0:
+		f.verb = s[0]
+	case len(s) > 0:
+		return f, false
+	}
+	return f, true
+}
+
+func isAlign(char byte) bool {
+	return strings.IndexByte("<>^=", char) >= 0
+}
+
+// leadingInt parses the digits s starts with, n is -1 when there are
+// none.
+func leadingInt(s string) (n int, rest string, ok bool) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	if i == 0 {
+		return -1, s, true
+	}
+	n, err := strconv.Atoi(s[:i])
+	return n, s[i:], err == nil && n <= math.MaxInt32
+}
+
+// repr gives a value as it is written in scripts.
+func (e *Evaluator) repr(v Value) string {
+	switch v := v.(type) {
+	case Str:
+		return strconv.Quote(string(v))
+	case Decimal:
+		return v.String() + "d"
+	}
+	return e.toStr(v)
+}
+
+// format formats a value of an f-string. Without a spec it gives what
+// println prints, values with '__format__' format themselves.
+func (e *Evaluator) format(v Value, conv byte, spec string) string {
+	switch conv {
+	case 'r':
+		v = Str(e.repr(v))
+	case 's':
+		v = Str(e.toStr(v))
+	}
+	if m := protoMethod(v, "__format__"); m != nil {
+		s, ok := first(m.call(e, []Value{Str(spec)})).(Str)
+		if !ok {
+			Raise(newError("TypeError", "'__format__' must return a Str"))
+		}
+		return string(s)
+	}
+	if spec == "" {
+		return e.toStr(v)
+	}
+	f, ok := parseFormatSpec(spec)
+	if !ok {
+		Raise(newError("ValueError", "invalid format spec '%s'", spec))
+	}
+	var sign, prefix, body string
+	switch n := v.(type) {
+	case Int, BigInt:
+		sign, prefix, body, ok = formatInt(bigOf(n), f)
+	case Num:
+		sign, body, ok = formatFloat(float64(n), f)
+	case Decimal:
+		sign, body, ok = e.formatDecimal(n, f)
+	default:
+		body = e.toStr(v)
+		ok = f.sign == 0 && !f.alt && f.grouping == 0 && f.align != '=' &&
+			(f.verb == 0 || f.verb == 's')
+		if f.precision >= 0 && utf8.RuneCountInString(body) > f.precision {
+			body = string([]rune(body)[:f.precision])
+		}
+		if f.align == 0 {
+			f.align = '<'
+		}
+	}
+	if !ok {
+		Raise(newError("ValueError", "invalid format spec '%s' for %s", spec, typeName(v)))
+	}
+	pad := f.width - utf8.RuneCountInString(sign+prefix+body)
+	if pad <= 0 {
+		return sign + prefix + body
+	}
+	e.alloc(pad * utf8.RuneLen(f.fill))
+	fill := strings.Repeat(string(f.fill), pad)
+	switch f.align {
+	case '<':
+		return sign + prefix + body + fill
+	case '^':
+		left := strings.Repeat(string(f.fill), pad/2)
+		return left + sign + prefix + body + fill[len(left):]
+	case '=':
+		return sign + prefix + fill + body
+	}
+	return fill + sign + prefix + body
+}
+
+// signOf gives the sign a number is written with.
+func signOf(neg bool, f formatSpec) string {
+	switch {
+	case neg:
+		return "-"
+	case f.sign == '+' || f.sign == ' ':
+		return string(f.sign)
+	}
+	return ""
+}
+
+func formatInt(x *big.Int, f formatSpec) (sign, prefix, body string, ok bool) {
+	base := 10
+	switch f.verb {
+	case 0, 'd':
+	case 'b':
+		base, prefix = 2, "0b"
+	case 'o':
+		base, prefix = 8, "0o"
+	case 'x':
+		base, prefix = 16, "0x"
+	case 'X':
+		base, prefix = 16, "0X"
+	case 'e', 'E', 'f', 'F', 'g', 'G', '%':
+		fl, _ := toFloat(intValue(x))
+		sign, body, ok = formatFloat(fl, f)
+		return sign, "", body, ok
+	default:
+		return "", "", "", false
+	}
+	if f.precision >= 0 || f.grouping == ',' && base != 10 {
+		return "", "", "", false
+	}
+	if !f.alt {
+		prefix = ""
+	}
+	body = new(big.Int).Abs(x).Text(base)
+	if f.verb == 'X' {
+		body = strings.ToUpper(body)
+	}
+	if f.grouping != 0 {
+		every := 3
+		if base != 10 {
+			every = 4
+		}
+		body = group(body, f.grouping, every)
+	}
+	return signOf(x.Sign() < 0, f), prefix, body, true
+}
+
+func formatFloat(x float64, f formatSpec) (sign, body string, ok bool) {
+	sign = signOf(math.Signbit(x) && !math.IsNaN(x), f)
+	x = math.Abs(x)
+	prec := f.precision
+	if prec < 0 {
+		prec = 6
+	}
+	switch {
+	case math.IsInf(x, 0) || math.IsNaN(x):
+		body = "inf"
+		if math.IsNaN(x) {
+			body = "nan"
+		}
+		if strings.IndexByte("EFG", f.verb) >= 0 {
+			body = strings.ToUpper(body)
+		}
+		if f.verb == '%' {
+			body += "%"
+		}
+	case f.verb == 0 && f.precision < 0:
+		body = Num(x).String()
+	case f.verb == 0:
+		body = strconv.FormatFloat(x, 'g', max(prec, 1), 64)
+	case f.verb == 'f' || f.verb == 'F':
+		body = strconv.FormatFloat(x, 'f', prec, 64)
+	case f.verb == 'e' || f.verb == 'E' || f.verb == 'g' || f.verb == 'G':
+		if f.verb == 'g' || f.verb == 'G' {
+			prec = max(prec, 1)
+		}
+		body = strconv.FormatFloat(x, lowerChar(f.verb), prec, 64)
+		if f.verb == 'E' || f.verb == 'G' {
+			body = strings.ToUpper(body)
+		}
+	case f.verb == '%':
+		body = strconv.FormatFloat(x*100, 'f', prec, 64) + "%"
+	default:
+		return "", "", false
+	}
+	if f.grouping != 0 {
+		body = groupNumber(body, f.grouping)
+	}
+	return sign, body, true
+}
+
+// formatDecimal formats decimals exactly with the types 'f' and '%',
+// the others format the nearest float.
+func (e *Evaluator) formatDecimal(d Decimal, f formatSpec) (sign, body string, ok bool) {
+	switch f.verb {
+	case 0, 'f', 'F', '%':
+		if f.verb == 0 && f.precision >= 0 {
+			break
+		}
+		if f.verb == '%' {
+			d = Decimal{new(big.Int).Mul(d.coef, big.NewInt(100)), d.scale}
+		}
+		if f.precision >= 0 {
+			d = d.rescale(int32(f.precision), e.DecimalRounding)
+		} else if f.verb == '%' {
+			d = d.trim(max(d.scale-2, 0))
+		}
+		body = Decimal{new(big.Int).Abs(d.coef), d.scale}.String()
+		if f.verb == '%' {
+			body += "%"
+		}
+		if f.grouping != 0 {
+			body = groupNumber(body, f.grouping)
+		}
+		return signOf(d.coef.Sign() < 0, f), body, true
+	}
+	return formatFloat(d.Float64(), f)
+}
+
+// groupNumber groups the digits before the point of a number.
+func groupNumber(s string, sep byte) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return group(s[:i], sep, 3) + s[i:]
+}
+
+// group separates digits into groups of every digits from the right.
+func group(digits string, sep byte, every int) string {
+	var res strings.Builder
+	for i := range len(digits) {
+		if i > 0 && (len(digits)-i)%every == 0 {
+			res.WriteByte(sep)
+		}
+		res.WriteByte(digits[i])
+	}
+	return res.String()
+}
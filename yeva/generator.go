@@ -0,0 +1,39 @@
+package yeva
+
+// Generator gives the values of a generator expression lazily. Its frame
+// is suspended after each value and resumed for the next one.
+type Generator struct {
+	frame   *frame  // nil once exhausted
+	stack   []Value // values of the frame while it is suspended
+	running bool
+}
+
+func (e *Evaluator) newGenerator(f *Func, args ...Value) *Generator {
+	e.alloc(frameSize + f.Code.locals*valueSize)
+	env := newEnv(f.Closure, f.Code.locals)
+	copy(env.slots, args)
+	g := &Generator{}
+	g.frame = &frame{fn: f, env: env, gen: g}
+	return g
+}
+
+// resume runs the frame of a generator until it yields its next value,
+// ok is false once the frame returns.
+func (e *Evaluator) resume(g *Generator) (vals []Value, ok bool) {
+	if g.running {
+		Raise(newError("ValueError", "generator already executing"))
+	}
+	fr := g.frame
+	if fr == nil {
+		return nil, false
+	}
+	e.checkDepth()
+	g.frame, g.running = nil, true
+	defer func() { g.running = false }()
+	fr.base = len(e.stack)
+	fr.handlers = len(e.handlers)
+	e.stack = append(e.stack, g.stack...)
+	e.frames = append(e.frames, fr)
+	vals = e.run(len(e.frames) - 1)
+	return vals, g.frame != nil
+}
@@ -0,0 +1,76 @@
+package yeva
+
+import "fmt"
+
+// metamethods names the prototype methods called by the operators for
+// values other than numbers and strings. The reflected method is called
+// on the right operand when the left one has no method.
+var metamethods = [...]struct{ name, reflected string }{
+	opAdd:          {"__add__", "__radd__"},
+	opSub:          {"__sub__", "__rsub__"},
+	opMul:          {"__mul__", "__rmul__"},
+	opDiv:          {"__div__", "__rdiv__"},
+	opMod:          {"__mod__", "__rmod__"},
+	opPow:          {"__pow__", "__rpow__"},
+	opFloorDiv:     {"__floordiv__", "__rfloordiv__"},
+	opLess:         {"__lt__", "__gt__"},
+	opLessEqual:    {"__le__", "__ge__"},
+	opGreater:      {"__gt__", "__lt__"},
+	opGreaterEqual: {"__ge__", "__le__"},
+	opBitAnd:       {"__and__", "__rand__"},
+	opBitOr:        {"__or__", "__ror__"},
+	opBitXor:       {"__xor__", "__rxor__"},
+	opShiftLeft:    {"__lshift__", "__rlshift__"},
+	opShiftRight:   {"__rshift__", "__rrshift__"},
+}
+
+// metaOperation calls the metamethod of a binary operator and tells
+// whether one was found.
+func (e *Evaluator) metaOperation(a, b Value, op opCode) (Value, bool) {
+	names := metamethods[op]
+	if m := protoMethod(a, names.name); m != nil {
+		return first(m.call(e, one(b))), true
+	}
+	if m := protoMethod(b, names.reflected); m != nil {
+		return first(m.call(e, one(a))), true
+	}
+	return nil, false
+}
+
+// truthy is valueToBool asking '__bool__' first.
+func (e *Evaluator) truthy(v Value) Bool {
+	if b, ok := v.(Bool); ok {
+		return b
+	}
+	if m := protoMethod(v, "__bool__"); m != nil {
+		return valueToBool(first(m.call(e, nil)))
+	}
+	return valueToBool(v)
+}
+
+// toStr formats a value for printing, with '__str__' when the value
+// has it.
+func (e *Evaluator) toStr(v Value) string {
+	if m := protoMethod(v, "__str__"); m != nil {
+		s, ok := first(m.call(e, nil)).(Str)
+		if !ok {
+			Raise(newError("TypeError", "'__str__' must return a Str"))
+		}
+		return string(s)
+	}
+	return fmt.Sprint(v)
+}
+
+// compare is compareValues ordering other values with '__lt__'.
+func (e *Evaluator) compare(a, b Value) (int, error) {
+	if protoMethod(a, "__lt__") == nil && protoMethod(b, "__gt__") == nil {
+		return compareValues(a, b)
+	}
+	if lt, ok := e.metaOperation(a, b, opLess); ok && bool(e.truthy(lt)) {
+		return -1, nil
+	}
+	if gt, ok := e.metaOperation(a, b, opGreater); ok && bool(e.truthy(gt)) {
+		return 1, nil
+	}
+	return 0, nil
+}
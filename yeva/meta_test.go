@@ -0,0 +1,48 @@
+package yeva
+
+import "testing"
+
+func TestMetamethods(t *testing.T) {
+	vec := `
+Vec = {}
+Vec.__add__ = lambda self o: Vec{ x: self.x + o.x, y: self.y + o.y }
+Vec.__sub__ = lambda self o: Vec{ x: self.x - o.x, y: self.y - o.y }
+Vec.__mul__ = lambda self k: Vec{ x: self.x * k, y: self.y * k }
+Vec.__rmul__ = lambda self k: Vec{ x: self.x * k, y: self.y * k }
+Vec.__neg__ = lambda self: Vec{ x: -self.x, y: -self.y }
+Vec.__eq__ = lambda self o: self.x == o.x and self.y == o.y
+Vec.__lt__ = lambda self o: self.x < o.x
+Vec.__str__ = lambda self: "({}, {})"->format(self.x, self.y)
+Vec.__bool__ = lambda self: self.x != 0 or self.y != 0
+Vec.__index__ = lambda self i: [self.x, self.y][i]
+def setindex(self, i, v):
+    if i == 0:
+        self.x = v
+    else:
+        self.y = v
+Vec.__setindex__ = setindex
+Vec.__call__ = lambda self k: self.x * k
+a = Vec{ x: 1, y: 2 }
+b = Vec{ x: 3, y: 4 }
+`
+	runScriptTests(t, []scriptTest{
+		{"add", vec + `x = "{}"->format(a + b)`, `"(4, 6)"`},
+		{"sub", vec + `x = "{}"->format(b - a)`, `"(2, 2)"`},
+		{"mul and reflected", vec + `x = "{} {}"->format(a * 2, 3 * a)`, `"(2, 4) (3, 6)"`},
+		{"neg", vec + `x = "{}"->format(-a)`, `"(-1, -2)"`},
+		{"eq", vec + `x = [a == Vec{ x: 1, y: 2 }, a != b]`, "[True, True]"},
+		{"lt", vec + `x = [a < b, a > b]`, "[True, False]"},
+		{"bool", vec + `
+x = []
+if Vec{ x: 0, y: 0 }:
+    x->push("zero")
+if a:
+    x->push("a")
+`, `["a"]`},
+		{"index", vec + `x = a[1]`, "2"},
+		{"setindex", vec + "a[0] = 9\nx = a.x\n", "9"},
+		{"call", vec + `x = a(5)`, "5"},
+		{"join", vec + `x = [a, b]->join(" ")`, `"(1, 2) (3, 4)"`},
+		{"proto chain", vec + "Vec3 = Vec{}\nc = Vec3{ x: 1, y: 1 }\nx = \"{}\"->format(c + c)\n", `"(2, 2)"`},
+	})
+}
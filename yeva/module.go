@@ -0,0 +1,134 @@
+package yeva
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ModuleExt is the file extension of modules found by file loaders.
+const ModuleExt = ".yeva"
+
+// ModuleLoader finds the source of modules imported by scripts.
+type ModuleLoader interface {
+	// Resolve returns the file of module name imported from file from,
+	// modules are cached by this file.
+	Resolve(name, from string) (file string, err error)
+	// Load reads the source of a resolved file.
+	Load(file string) ([]byte, error)
+}
+
+// FileLoader loads modules from the file system relative to the
+// importing file, module 'a.b' is found in 'a/b.yeva'.
+type FileLoader struct{}
+
+func (l FileLoader) Resolve(name, from string) (string, error) {
+	file := filepath.Join(filepath.Dir(from), filepath.FromSlash(modulePath(name)))
+	if _, err := os.Stat(file); err != nil {
+		return "", fmt.Errorf("no module named '%s'", name)
+	}
+	return file, nil
+}
+
+func (l FileLoader) Load(file string) ([]byte, error) {
+	return os.ReadFile(file)
+}
+
+// FSLoader loads modules from a file system like embed.FS relative to
+// the importing file.
+type FSLoader struct {
+	FS fs.FS
+}
+
+func (l FSLoader) Resolve(name, from string) (string, error) {
+	file := path.Join(path.Dir(filepath.ToSlash(from)), modulePath(name))
+	if _, err := fs.Stat(l.FS, file); err != nil {
+		return "", fmt.Errorf("no module named '%s'", name)
+	}
+	return file, nil
+}
+
+func (l FSLoader) Load(file string) ([]byte, error) {
+	return fs.ReadFile(l.FS, file)
+}
+
+// MapLoader loads modules from memory by their names.
+type MapLoader map[string]string
+
+func (l MapLoader) Resolve(name, from string) (string, error) {
+	if _, ok := l[name]; !ok {
+		return "", fmt.Errorf("no module named '%s'", name)
+	}
+	return name, nil
+}
+
+func (l MapLoader) Load(file string) ([]byte, error) {
+	return []byte(l[file]), nil
+}
+
+func modulePath(name string) string {
+	return strings.ReplaceAll(name, ".", "/") + ModuleExt
+}
+
+type module struct {
+	doc     *Doc
+	loading bool
+}
+
+// importModule evaluates a module once and gives back the doc
+// of its top-level bindings.
+func (e *Evaluator) importModule(name, from string) *Doc {
+	if e.Loader == nil {
+		Raise(newError("ImportError", "no module loader to import '%s'", name))
+	}
+	file, err := e.Loader.Resolve(name, from)
+	if err != nil {
+		Raise(newError("ImportError", "%s", err))
+	}
+	if m, ok := e.modules[file]; ok {
+		if m.loading {
+			i := len(e.importing) - 1
+			for e.importing[i] != file {
+				i--
+			}
+			cycle := append(e.importing[i:len(e.importing):len(e.importing)], file)
+			Raise(newError("ImportError", "import cycle: %s", strings.Join(cycle, " -> ")))
+		}
+		return m.doc
+	}
+
+	source, err := e.Loader.Load(file)
+	if err != nil {
+		Raise(newError("ImportError", "can't load module '%s': %s", name, err))
+	}
+	code, err := compileSource(file, source)
+	if err != nil {
+		Raise(newError("ImportError", "%s: %s", file, err))
+	}
+
+	m := &module{
+		doc:     &Doc{module: true},
+		loading: true,
+	}
+	if e.modules == nil {
+		e.modules = make(map[string]*module)
+	}
+	e.modules[file] = m
+	e.importing = append(e.importing, file)
+	done := false
+	defer func() {
+		e.importing = e.importing[:len(e.importing)-1]
+		m.loading = false
+		if !done {
+			delete(e.modules, file)
+		}
+	}()
+
+	main := &Func{Code: code, Name: code.name, module: m.doc}
+	main.call(e, nil)
+	done = true
+	return m.doc
+}
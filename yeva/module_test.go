@@ -0,0 +1,116 @@
+package yeva
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestImport(t *testing.T) {
+	loader := MapLoader{
+		"math":      "pi = 3\ndef double(n):\n    return n * 2\nprivate = pi\n",
+		"pkg.util":  "def hello():\n    return \"hi\"\n",
+		"counter":   "loads = {}\nloads.first = True\n",
+		"cycle_a":   "import cycle_b\n",
+		"cycle_b":   "import cycle_a\n",
+		"broken":    "x = (\n",
+		"uses_self": "from math import pi\ndef area(r):\n    return pi * r * r\n",
+		"state":     "n = 1\ndef get():\n    return n\ndef bump():\n    global n\n    n = n + 1\n",
+	}
+	tests := []scriptTest{
+		{"import", "import math\nx = math.double(math.pi)\n", "6"},
+		{"import as", "import math as m\nx = m.pi\n", "3"},
+		{"dotted", "import pkg.util\nx = util.hello()\n", `"hi"`},
+		{"from import", "from math import pi, double as twice\nx = twice(pi)\n", "6"},
+		{"module globals", "from uses_self import area\npi = 100\nx = area(2)\n", "12"},
+		{"module globals changed", `
+import state
+def f():
+    a = state.get()
+    state.n = 5
+    b = state.get()
+    state.bump()
+    return [a, b, state.get(), state.n]
+x = f()
+`, "[1, 5, 6, 6]"},
+		{"module global deleted", `
+import state
+state.n = None
+n = "main"
+x = state.get()
+`, `"main"`},
+		{"evaluated once", "import counter\nimport counter as again\ncounter.loads.second = True\nx = again.loads\n",
+			`{"first": True, "second": True}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New()
+			e.Loader = loader
+			if err := e.Interpret([]byte(tt.source)); err != nil {
+				t.Fatal(err)
+			}
+			if got := show(global(t, e, "x")); got != tt.want {
+				t.Errorf("x = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	errTests := []struct{ name, source, want string }{
+		{"missing", "import nope\n", "no module named 'nope'"},
+		{"missing name", "from math import nope\n", "can't import name 'nope'"},
+		{"cycle", "import cycle_a\n", "import cycle: cycle_a -> cycle_b -> cycle_a"},
+		{"compile error", "import broken\n", "broken: compile error"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New()
+			e.Loader = loader
+			err := e.Interpret([]byte(tt.source))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Interpret = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if err := New().Interpret([]byte("import math\n")); err == nil {
+		t.Error("import without a loader didn't fail")
+	}
+}
+
+func TestFSLoader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/a.yeva":     {Data: []byte("from b import v\n")},
+		"lib/b.yeva":     {Data: []byte("v = 7\n")},
+		"lib/sub/c.yeva": {Data: []byte("w = 8\n")},
+	}
+	e := New()
+	e.Loader = FSLoader{fsys}
+	err := e.InterpretFile("lib/main.yeva", []byte("import a\nimport sub.c\nx = a.v + c.w\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != "15" {
+		t.Errorf("x = %s, want 15", got)
+	}
+}
+
+func TestFileLoader(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lib", "b.yeva"), []byte("v = 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := New()
+	e.Loader = FileLoader{}
+	err := e.InterpretFile(filepath.Join(dir, "main.yeva"), []byte("import lib.b\nx = b.v\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != "2" {
+		t.Errorf("x = %s, want 2", got)
+	}
+}
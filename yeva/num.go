@@ -0,0 +1,511 @@
+package yeva
+
+import (
+	"cmp"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Int is an integer. Results that don't fit in int64 are BigInt and
+// BigInt results that fit are Int again, so every integer has one form.
+type Int int64
+
+// BigInt is an integer that doesn't fit in Int.
+type BigInt struct {
+	v *big.Int // never changed once in a BigInt
+}
+
+// NewInt gives x as an Int or, when it doesn't fit, as a BigInt.
+func NewInt(x *big.Int) Value {
+	return intValue(new(big.Int).Set(x))
+}
+
+// Big gives a copy of the integer.
+func (b BigInt) Big() *big.Int {
+	return new(big.Int).Set(b.v)
+}
+
+// intValue gives x as an Int when it fits, x isn't copied.
+func intValue(x *big.Int) Value {
+	if x.IsInt64() {
+		return Int(x.Int64())
+	}
+	return BigInt{x}
+}
+
+func bigOf(v Value) *big.Int {
+	if b, ok := v.(BigInt); ok {
+		return b.v
+	}
+	return big.NewInt(int64(v.(Int)))
+}
+
+func isInt(v Value) bool {
+	switch v.(type) {
+	case Int, BigInt:
+		return true
+	}
+	return false
+}
+
+func isNumber(v Value) bool {
+	switch v.(type) {
+	case Num, Int, BigInt, Decimal:
+		return true
+	}
+	return false
+}
+
+// toFloat converts a number to float64, integers too big for it raise
+// OverflowError.
+func toFloat(v Value) (float64, bool) {
+	f, ok := floatOf(v)
+	if math.IsInf(f, 0) && isInt(v) {
+		Raise(newError("OverflowError", "int too large to convert to float"))
+	}
+	return f, ok
+}
+
+// floatOf is toFloat giving an infinity for integers too big.
+func floatOf(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case Num:
+		return float64(v), true
+	case Int:
+		return float64(v), true
+	case BigInt:
+		f, _ := new(big.Float).SetInt(v.v).Float64()
+		return f, true
+	case Decimal:
+		return v.Float64(), true
+	}
+	return 0, false
+}
+
+// toIndex gives the int of an Int or an integral Num. Integers too big
+// for int give math.MaxInt, which is out of range of any index.
+func toIndex(v Value) (int, bool) {
+	switch v := v.(type) {
+	case Int:
+		if int64(v) != int64(int(v)) {
+			return math.MaxInt, true
+		}
+		return int(v), true
+	case BigInt:
+		return math.MaxInt, true
+	case Num:
+		i := int(v)
+		return i, Num(i) == v
+	}
+	return 0, false
+}
+
+// normNum gives integral floats as integers, so numbers that are equal
+// are the same doc key and have the same hash.
+func normNum(v Value) Value {
+	if d, ok := v.(Decimal); ok {
+		return normDecimal(d)
+	}
+	n, ok := v.(Num)
+	if !ok || math.Trunc(float64(n)) != float64(n) || math.IsInf(float64(n), 0) {
+		return v
+	}
+	if n >= math.MinInt64 && n < math.MaxInt64 {
+		return Int(n)
+	}
+	x, _ := big.NewFloat(float64(n)).Int(nil)
+	return intValue(x)
+}
+
+// compareNums compares numbers exactly, ok is false when a value isn't
+// a number or is NaN.
+func compareNums(a, b Value) (c int, ok bool) {
+	switch a := a.(type) {
+	case Int:
+		if b, ok := b.(Int); ok {
+			return cmp.Compare(a, b), true
+		}
+	case Num:
+		if b, ok := b.(Num); ok {
+			if math.IsNaN(float64(a)) || math.IsNaN(float64(b)) {
+				return 0, false
+			}
+			return cmp.Compare(a, b), true
+		}
+	}
+	if isDecimal(a) || isDecimal(b) {
+		return compareDecimals(a, b)
+	}
+	fa, ok1 := bigFloat(a)
+	fb, ok2 := bigFloat(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return fa.Cmp(fb), true
+}
+
+func bigFloat(v Value) (*big.Float, bool) {
+	switch v := v.(type) {
+	case Num:
+		if math.IsNaN(float64(v)) {
+			return nil, false
+		}
+		return new(big.Float).SetFloat64(float64(v)), true
+	case Int:
+		return new(big.Float).SetInt64(int64(v)), true
+	case BigInt:
+		return new(big.Float).SetInt(v.v), true
+	}
+	return nil, false
+}
+
+// numberOperation applies an arithmetic or comparison operator. Integers
+// stay exact, '/' and any float operand give a float.
+func (e *Evaluator) numberOperation(a, b Value, op tokenType) Value {
+	switch op {
+	case tokenLess, tokenLessEqual, tokenGreater, tokenGreaterEqual:
+		c, ok := compareNums(a, b)
+		if !ok {
+			if isNumber(a) && isNumber(b) {
+				return Bool(false) // NaN
+			}
+			Raise(Str("operands must be numbers"))
+		}
+		switch op {
+		case tokenLess:
+			return Bool(c < 0)
+		case tokenLessEqual:
+			return Bool(c <= 0)
+		case tokenGreater:
+			return Bool(c > 0)
+		}
+		return Bool(c >= 0)
+	}
+	switch op {
+	case tokenAmper, tokenPipe, tokenCaret, tokenLessLess, tokenGreaterGreater:
+		if !isInt(a) || !isInt(b) {
+			Raise(newError("TypeError", "unsupported operand types for %s: %s and %s",
+				bitOperators[op], typeName(a), typeName(b)))
+		}
+		return e.intOperation(a, b, op)
+	}
+	if isDecimal(a) || isDecimal(b) {
+		return e.decimalOperation(a, b, op)
+	}
+	if isInt(a) && isInt(b) && op != tokenSlash {
+		return e.intOperation(a, b, op)
+	}
+	if isInt(a) && isInt(b) {
+		return intDivision(bigOf(a), bigOf(b))
+	}
+	af, ok1 := toFloat(a)
+	bf, ok2 := toFloat(b)
+	if !ok1 || !ok2 {
+		Raise(Str("operands must be numbers"))
+	}
+	an, bn := Num(af), Num(bf)
+	switch op {
+	case tokenPlus:
+		return an + bn
+	case tokenMinus:
+		return an - bn
+	case tokenStar:
+		return an * bn
+	case tokenSlash:
+		return an / bn
+	case tokenPersent:
+		m := math.Mod(af, bf)
+		if m != 0 && (m < 0) != (bf < 0) {
+			m += bf // the sign of the divisor
+		}
+		return Num(m)
+	case tokenStarStar:
+		return Num(math.Pow(af, bf))
+	case tokenSlashSlash:
+		return Num(math.Floor(af / bf))
+	}
+	panic("number operation: unknown operation")
+}
+
+func (e *Evaluator) intOperation(a, b Value, op tokenType) Value {
+	if x, ok := a.(Int); ok {
+		if y, ok := b.(Int); ok {
+			if v, ok := smallIntOperation(x, y, op); ok {
+				return v
+			}
+		}
+	}
+	x, y := bigOf(a), bigOf(b)
+	z := new(big.Int)
+	switch op {
+	case tokenPlus:
+		z.Add(x, y)
+	case tokenMinus:
+		z.Sub(x, y)
+	case tokenStar:
+		e.alloc((x.BitLen() + y.BitLen()) / 8)
+		z.Mul(x, y)
+	case tokenSlashSlash, tokenPersent:
+		if y.Sign() == 0 {
+			Raise(newError("ZeroDivisionError", "integer division or modulo by zero"))
+		}
+		r := new(big.Int)
+		z.QuoRem(x, y, r)
+		if r.Sign() != 0 && r.Sign() != y.Sign() {
+			z.Sub(z, big.NewInt(1))
+			r.Add(r, y)
+		}
+		if op == tokenPersent {
+			z = r
+		}
+	case tokenStarStar:
+		if y.Sign() < 0 {
+			xf, _ := toFloat(a)
+			yf, _ := toFloat(b)
+			return Num(math.Pow(xf, yf))
+		}
+		if x.CmpAbs(big.NewInt(1)) > 0 {
+			// |x| ** y has at least (bits of |x| - 1) * y + 1 bits.
+			if !y.IsInt64() || y.Int64() > maxIntBits/int64(x.BitLen()-1) {
+				Raise(newError("MemoryError", "integer power is too big"))
+			}
+			e.allocInt(int64(x.BitLen()-1)*y.Int64()+1, "power")
+		}
+		z.Exp(x, y, nil)
+	case tokenAmper:
+		z.And(x, y)
+	case tokenPipe:
+		z.Or(x, y)
+	case tokenCaret:
+		z.Xor(x, y)
+	case tokenLessLess, tokenGreaterGreater:
+		if y.Sign() < 0 {
+			Raise(newError("ValueError", "negative shift count"))
+		}
+		if op == tokenGreaterGreater {
+			if !y.IsInt64() || y.Int64() > int64(x.BitLen()) {
+				return Int(x.Sign() >> 1) // 0 or -1
+			}
+			z.Rsh(x, uint(y.Int64()))
+			break
+		}
+		if x.Sign() == 0 {
+			return Int(0)
+		}
+		if !y.IsInt64() || y.Int64() > maxIntBits {
+			Raise(newError("MemoryError", "integer shift is too big"))
+		}
+		e.allocInt(int64(x.BitLen())+y.Int64(), "shift")
+		z.Lsh(x, uint(y.Int64()))
+	default:
+		panic("int operation: unknown operation")
+	}
+	return intValue(z)
+}
+
+// maxIntBits is the most bits a result of ** or << can have, so that a
+// huge one raises MemoryError at once instead of being computed for
+// ages, whether or not MaxMemory is set.
+const maxIntBits = math.MaxInt32
+
+// allocInt accounts an integer of the given bits made by an operation,
+// raising MemoryError if it has more than maxIntBits.
+func (e *Evaluator) allocInt(bits int64, operation string) {
+	if bits > maxIntBits {
+		Raise(newError("MemoryError", "integer %s is too big", operation))
+	}
+	e.alloc(int(bits / 8))
+}
+
+// bitOperators are the symbols of the bitwise operators for errors.
+var bitOperators = map[tokenType]string{
+	tokenAmper:          "&",
+	tokenPipe:           "|",
+	tokenCaret:          "^",
+	tokenLessLess:       "<<",
+	tokenGreaterGreater: ">>",
+}
+
+// fastOperation applies a binary operator to two Ints or two Nums, which
+// have no metamethods to look up. ok is false for other operands and
+// for results left to numberOperation, like overflowing ones.
+func fastOperation(a, b Value, op opCode) (v Value, ok bool) {
+	switch x := a.(type) {
+	case Int:
+		y, ok := b.(Int)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case opLess:
+			return Bool(x < y), true
+		case opLessEqual:
+			return Bool(x <= y), true
+		case opGreater:
+			return Bool(x > y), true
+		case opGreaterEqual:
+			return Bool(x >= y), true
+		}
+		return smallIntOperation(x, y, binaryTokens[op])
+	case Num:
+		y, ok := b.(Num)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case opAdd:
+			return x + y, true
+		case opSub:
+			return x - y, true
+		case opMul:
+			return x * y, true
+		case opDiv:
+			return x / y, true
+		case opLess:
+			return Bool(x < y), true
+		case opLessEqual:
+			return Bool(x <= y), true
+		case opGreater:
+			return Bool(x > y), true
+		case opGreaterEqual:
+			return Bool(x >= y), true
+		}
+	}
+	return nil, false
+}
+
+// smallIntOperation computes an operation of two Ints, ok is false when
+// the result needs a BigInt or the divisor is 0.
+func smallIntOperation(x, y Int, op tokenType) (v Value, ok bool) {
+	switch op {
+	case tokenPlus:
+		if z := x + y; (z > x) == (y > 0) {
+			return z, true
+		}
+	case tokenMinus:
+		if z := x - y; (z < x) == (y > 0) {
+			return z, true
+		}
+	case tokenStar:
+		if x == 0 || y == 0 {
+			return Int(0), true
+		}
+		if x == math.MinInt64 || y == math.MinInt64 {
+			return nil, false
+		}
+		if z := x * y; z/y == x {
+			return z, true
+		}
+	case tokenAmper:
+		return x & y, true
+	case tokenPipe:
+		return x | y, true
+	case tokenCaret:
+		return x ^ y, true
+	case tokenGreaterGreater:
+		if y >= 0 {
+			return x >> min(y, 63), true
+		}
+	case tokenLessLess:
+		if y >= 0 && y < 63 && x<<y>>y == x {
+			return x << y, true
+		}
+	case tokenSlashSlash, tokenPersent:
+		if y == 0 || x == math.MinInt64 && y == -1 {
+			return nil, false
+		}
+		q, r := x/y, x%y
+		if r != 0 && (r < 0) != (y < 0) {
+			q, r = q-1, r+y
+		}
+		if op == tokenPersent {
+			return r, true
+		}
+		return q, true
+	}
+	return nil, false
+}
+
+// intDivision divides integers exactly and rounds the result to a float.
+func intDivision(x, y *big.Int) Value {
+	if y.Sign() == 0 {
+		Raise(newError("ZeroDivisionError", "division by zero"))
+	}
+	f, _ := new(big.Rat).SetFrac(x, y).Float64()
+	if math.IsInf(f, 0) {
+		Raise(newError("OverflowError", "integer division result too large for a float"))
+	}
+	return Num(f)
+}
+
+// negate negates a number.
+func negate(v Value) (Value, bool) {
+	switch v := v.(type) {
+	case Num:
+		return -v, true
+	case Int:
+		if v == math.MinInt64 {
+			return intValue(new(big.Int).Neg(bigOf(v))), true
+		}
+		return -v, true
+	case BigInt:
+		return intValue(new(big.Int).Neg(v.v)), true
+	case Decimal:
+		return Decimal{new(big.Int).Neg(v.coef), v.scale}, true
+	}
+	return nil, false
+}
+
+// invert gives the bitwise inversion of an integer, -x - 1.
+func invert(v Value) (Value, bool) {
+	switch v := v.(type) {
+	case Int:
+		return ^v, true
+	case BigInt:
+		return intValue(new(big.Int).Not(v.v)), true
+	}
+	return nil, false
+}
+
+// parseInt parses an integer literal, underscores are allowed between
+// digits.
+func parseInt(s string, base int) (Value, bool) {
+	x, ok := new(big.Int).SetString(strings.ReplaceAll(s, "_", ""), base)
+	if !ok {
+		return nil, false
+	}
+	return intValue(x), true
+}
+
+var nativeInt = wrapFunc(reflect.ValueOf(func(v Value) (Value, error) {
+	switch v := v.(type) {
+	case Int, BigInt:
+		return v, nil
+	case Num:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil, newError("ValueError", "can't convert %v to Int", v)
+		}
+		return normNum(Num(math.Trunc(float64(v)))), nil
+	case Str:
+		if n, ok := parseInt(strings.TrimSpace(string(v)), 10); ok {
+			return n, nil
+		}
+	}
+	return nil, newError("ValueError", "can't convert %s %v to Int", typeName(v), v)
+}), "int")
+
+var nativeFloat = wrapFunc(reflect.ValueOf(func(v Value) (Num, error) {
+	if f, ok := toFloat(v); ok {
+		return Num(f), nil
+	}
+	if s, ok := v.(Str); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(s)), 64)
+		if err == nil {
+			return Num(f), nil
+		}
+	}
+	return 0, newError("ValueError", "can't convert %s %v to Num", typeName(v), v)
+}), "float")
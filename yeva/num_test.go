@@ -0,0 +1,135 @@
+package yeva
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestInt(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"literals", `x = [0x1f, 0o17, 0b101, 1_000]`, "[31, 15, 5, 1000]"},
+		{"big literal", `x = 0xffffffffffffffffffff`, "1208925819614629174706175"},
+		{"overflow promotes", `x = 9223372036854775807 + 1`, "9223372036854775808"},
+		{"big shrinks", `x = 9223372036854775807 + 1 - 1 == 9223372036854775807`, "True"},
+		{"true division", `x = 7 / 2`, "3.5"},
+		{"floor division", `x = [7 // 2, -7 // 2, 7 % 3, -7 % 3]`, "[3, -4, 1, 2]"},
+		{"mixing", `x = 1 + 0.5`, "1.5"},
+		{"power", `x = [2 ** 10, 2 ** -1, 2 ** 3 ** 2]`, "[1024, 0.5, 512]"},
+		{"bitwise", `x = [6 & 3, 6 | 3, 6 ^ 3, ~6, 1 << 3, -16 >> 2]`, "[2, 7, 5, -7, 8, -4]"},
+		{"conversions", `x = [int("42"), int(3.9), float(2)]`, "[42, 3, 2.0]"},
+		{"equal across types", `x = [1 == 1.0, 2 < 2.5]`, "[True, True]"},
+	})
+
+	for _, source := range []string{`x = 1 // 0`, `x = 1 % 0`, `x = int("a")`, `x = 1 << -1`, `x = 1.5 & 1`} {
+		if err := New().Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%q) didn't fail", source)
+		}
+	}
+}
+
+func TestIntSize(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"huge exponents", `x = [1 ** (2 ** 80), (-1) ** (2 ** 80 + 1), 0 ** (2 ** 80)]`, "[1, -1, 0]"},
+		{"huge shifts", `x = [0 << (2 ** 80), 5 >> (2 ** 80), -5 >> (2 ** 80)]`, "[0, 0, -1]"},
+		{"big power", `x = 2 ** 100 == 1 << 100`, "True"},
+	})
+
+	// Without MaxMemory these must raise instead of computing for ages.
+	for _, source := range []string{
+		`x = 2 ** (2 ** 40)`,
+		`x = 2 ** (2 ** 31)`,
+		`x = (2 ** 40) ** (2 ** 26)`,
+		`x = 1 << (2 ** 40)`,
+		`x = 1 << (2 ** 31)`,
+		`x = (2 ** 40) << (2 ** 31 - 8)`,
+	} {
+		err := New().Interpret([]byte(source))
+		var exc *RuntimeException
+		if !errors.As(err, &exc) {
+			t.Errorf("Interpret(%q) = %v, want MemoryError", source, err)
+			continue
+		}
+		if v, ok := exc.Value.(*Error); !ok || v.Name != "MemoryError" {
+			t.Errorf("Interpret(%q) raised %v, want MemoryError", source, exc.Value)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"exact sum", `x = 0.1d + 0.2d == 0.3d`, "True"},
+		{"keeps scale", `x = 1.10d + 2.205d`, "3.305"},
+		{"multiply", `x = 1.5d * 3`, "4.5"},
+		{"divide", `x = 1d / 3`, "0.3333333333333333333333333333"},
+		{"exact quotient", `x = 1.00d / 4`, "0.25"},
+		{"round", `x = [2.675d->round(2), 2.665d->round(2), 2.665d->round(2, "half_up")]`, "[2.68, 2.66, 2.67]"},
+		{"power", `x = [1.1d ** 2, 2d ** -2]`, "[1.21, 0.25]"},
+		{"compare", `x = [1.10d == 1.1d, 1.1d < 2, 1.5d > 1]`, "[True, True, True]"},
+		{"convert", `x = [decimal("1.25"), decimal(3)]`, "[1.25, 3]"},
+		{"floor division", `x = [7.5d // 2, 7.5d % 2]`, "[3, 1.5]"},
+	})
+
+	e := New()
+	e.DecimalPrecision = 5
+	e.DecimalRounding = RoundDown
+	if err := e.Interpret([]byte(`x = 2d / 3`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := show(global(t, e, "x")); got != "0.66666" {
+		t.Errorf("2d / 3 = %s with precision 5 rounding down", got)
+	}
+
+	for _, source := range []string{`x = 1d / 0`, `x = 1d + 0.5`, `x = 2d ** 0.5`} {
+		if err := New().Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%q) didn't fail", source)
+		}
+	}
+}
+
+func TestDecimalGo(t *testing.T) {
+	d, err := ParseDecimal("12.340")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.String() != "12.340" || d.Scale() != 3 || d.Coef().Int64() != 12340 {
+		t.Errorf("ParseDecimal = %v", d)
+	}
+	if r := d.Rat(); r.Cmp(big.NewRat(617, 50)) != 0 {
+		t.Errorf("Rat() = %v", r)
+	}
+	v, err := FromGo(d)
+	if err != nil || v != Value(d) {
+		t.Errorf("FromGo(%v) = %v, %v", d, v, err)
+	}
+	if _, err := ParseDecimal("1.2.3"); err == nil {
+		t.Error("ParseDecimal(1.2.3) didn't fail")
+	}
+}
+
+func TestDecimalPower(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"negative", `x = 2.5d ** -2`, "0.16"},
+		{"int64 min", `x = [1d ** -9223372036854775808, (-1d) ** -9223372036854775808]`, "[1, 1]"},
+		{"big", `x = [1d ** (2 ** 80), (-1d) ** (2 ** 80 + 1), 0d ** (2 ** 80)]`, "[1, -1, 0]"},
+		{"negative big", `x = (-1d) ** -(2 ** 80 + 1)`, "-1"},
+	})
+
+	for _, tt := range []struct{ source, name string }{
+		{`x = 2.5d ** -9223372036854775808`, "MemoryError"},
+		{`x = 2.5d ** (2 ** 80)`, "MemoryError"},
+		{`x = 2d ** -(2 ** 80)`, "MemoryError"},
+		{`x = 0d ** -(2 ** 80)`, "ZeroDivisionError"},
+		{`x = 2d ** 1.5d`, "TypeError"},
+	} {
+		err := New().Interpret([]byte(tt.source))
+		var exc *RuntimeException
+		if !errors.As(err, &exc) {
+			t.Errorf("Interpret(%q) = %v, want %s", tt.source, err, tt.name)
+			continue
+		}
+		if v, ok := exc.Value.(*Error); !ok || v.Name != tt.name {
+			t.Errorf("Interpret(%q) raised %v, want %s", tt.source, exc.Value, tt.name)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type defType int
@@ -39,6 +40,11 @@ func newParser(source []byte) *parser {
 	}
 }
 
+// pos is the position of the previous token.
+func (p *parser) pos() position {
+	return position{p.previous.line, p.previous.col}
+}
+
 func (p *parser) advance() {
 	p.previous = p.current
 	p.current = p.scanner.scanToken()
@@ -81,13 +87,17 @@ func (p *parser) consume(type_ tokenType, message string) {
 type parseError string
 
 func (p *parser) errorAt(tk token, message string) {
-	if tk.tokenType == tokenIdentifier ||
+	if tk.tokenType == tokenError { // the scanner knows better what's wrong
+		message = fmt.Sprintf("line %d:%d: %s", tk.line, tk.col, tk.literal)
+	} else if tk.tokenType == tokenIdentifier ||
 		tk.tokenType == tokenString ||
+		tk.tokenType == tokenFString ||
 		tk.tokenType == tokenFloat ||
-		tk.tokenType == tokenInteger {
-		message = fmt.Sprintf("line %d at '%s': %s", tk.line, tk.literal, message)
+		tk.tokenType == tokenInteger ||
+		tk.tokenType == tokenDecimal {
+		message = fmt.Sprintf("line %d:%d at '%s': %s", tk.line, tk.col, tk.literal, message)
 	} else {
-		message = fmt.Sprintf("line %d at token (%s): %s", tk.line, tk.tokenType, message)
+		message = fmt.Sprintf("line %d:%d at token (%s): %s", tk.line, tk.col, tk.tokenType, message)
 	}
 	p.errors = append(p.errors, message)
 	panic(parseError(message))
@@ -145,19 +155,26 @@ func (p *parser) stmt() (stmt astStmt) {
 		return p.continueStmt()
 	} else if p.match(tokenReturn) {
 		return p.returnStmt()
+	} else if p.match(tokenImport) {
+		return p.importStmt()
+	} else if p.match(tokenFrom) {
+		return p.fromImportStmt()
 	} else {
 		expr := p.expr(precLowest)
 		if p.check(tokenEqual) || p.check(tokenComma) {
 			return p.assignStmt(expr)
 		}
+		if _, ok := augmentedOps[p.current.tokenType]; ok {
+			return p.augAssignStmt(expr)
+		}
 		p.consume(tokenNewLine, "expect new line")
-		return &exprStmt{expr}
+		return &exprStmt{expr.pos(), expr}
 	}
 }
 
 func isLeftHand(expr astExpr) bool {
 	switch expr.(type) {
-	case *ident, *indexExpr:
+	case *ident, *indexExpr, *sliceExpr:
 		return true
 	default:
 		return false
@@ -174,7 +191,7 @@ func (p *parser) declStmt() *declStmt {
 	case tokenGlobal:
 		t = varGlobal
 	}
-	decl := &declStmt{varType: t}
+	decl := &declStmt{position: p.pos(), varType: t}
 	if p.defCtx == nil {
 		p.errorAtPrevious("variable modifier outside function")
 	}
@@ -189,11 +206,55 @@ func (p *parser) declStmt() *declStmt {
 	return decl
 }
 
+func (p *parser) importStmt() *importStmt {
+	stmt := &importStmt{position: p.pos()}
+	stmt.module = p.moduleName()
+	stmt.as = stmt.module[strings.LastIndexByte(stmt.module, '.')+1:]
+	if p.match(tokenAs) {
+		p.consume(tokenIdentifier, "expect module alias")
+		stmt.as = p.previous.literal
+	}
+	p.consume(tokenNewLine, "expect new line")
+	return stmt
+}
+
+func (p *parser) fromImportStmt() *fromImportStmt {
+	stmt := &fromImportStmt{position: p.pos()}
+	stmt.module = p.moduleName()
+	p.consume(tokenImport, "expect 'import'")
+	for {
+		p.consume(tokenIdentifier, "expect imported name")
+		name := p.previous.literal
+		stmt.names = append(stmt.names, name)
+		if p.match(tokenAs) {
+			p.consume(tokenIdentifier, "expect name alias")
+			name = p.previous.literal
+		}
+		stmt.vars = append(stmt.vars, name)
+		if !p.match(tokenComma) {
+			break
+		}
+	}
+	p.consume(tokenNewLine, "expect new line")
+	return stmt
+}
+
+// moduleName parses a dotted module name like 'a.b.c'.
+func (p *parser) moduleName() string {
+	p.consume(tokenIdentifier, "expect module name")
+	name := p.previous.literal
+	for p.match(tokenDot) {
+		p.consume(tokenIdentifier, "expect module name")
+		name += "." + p.previous.literal
+	}
+	return name
+}
+
 func (p *parser) breakStmt() *breakStmt {
 	if p.loopCtx == nil {
 		p.errorAtPrevious("'break' outside function")
 	}
-	stmt := &breakStmt{}
+	stmt := &breakStmt{p.pos()}
 	p.consume(tokenNewLine, "expect new line")
 	return stmt
 }
@@ -202,19 +263,19 @@ func (p *parser) continueStmt() *continueStmt {
 	if p.loopCtx == nil {
 		p.errorAtPrevious("'continue' outside function")
 	}
-	stmt := &continueStmt{}
+	stmt := &continueStmt{p.pos()}
 	p.consume(tokenNewLine, "expect new line")
 	return stmt
 }
 
 func (p *parser) raiseStmt() *raiseStmt {
-	stmt := &raiseStmt{p.expr(precLowest)}
+	stmt := &raiseStmt{p.pos(), p.expr(precLowest)}
 	p.consume(tokenNewLine, "expect new line")
 	return stmt
 }
 
 func (p *parser) tryStmt() *tryStmt {
-	stmt := &tryStmt{as: "_"}
+	stmt := &tryStmt{position: p.pos(), as: "_"}
 	stmt.try = p.block()
 	if p.match(tokenExcept) {
 		if p.match(tokenAs) {
@@ -237,7 +298,8 @@ func (p *parser) returnStmt() *returnStmt {
 		p.errorAtPrevious("'return' outside function")
 	}
 	stmt := &returnStmt{
-		values: []astExpr{},
+		position: p.pos(),
+		values:   []astExpr{},
 	}
 	if p.match(tokenNewLine) {
 		return stmt
@@ -257,7 +319,8 @@ func (p *parser) assignStmt(first astExpr) *assignStmt {
 		p.errorAtPrevious("wrong assign target")
 	}
 	stmt := &assignStmt{
-		lefts: []astExpr{first},
+		position: first.pos(),
+		lefts:    []astExpr{first},
 	}
 	for p.match(tokenComma) {
 		left := p.expr(precLowest)
@@ -277,34 +340,82 @@ func (p *parser) assignStmt(first astExpr) *assignStmt {
 	return stmt
 }
 
+// augmentedOps maps augmented assignments to their operators.
+var augmentedOps = map[tokenType]tokenType{
+	tokenPlusEqual:           tokenPlus,
+	tokenMinusEqual:          tokenMinus,
+	tokenStarEqual:           tokenStar,
+	tokenSlashEqual:          tokenSlash,
+	tokenPersentEqual:        tokenPersent,
+	tokenSlashSlashEqual:     tokenSlashSlash,
+	tokenStarStarEqual:       tokenStarStar,
+	tokenAmperEqual:          tokenAmper,
+	tokenPipeEqual:           tokenPipe,
+	tokenCaretEqual:          tokenCaret,
+	tokenLessLessEqual:       tokenLessLess,
+	tokenGreaterGreaterEqual: tokenGreaterGreater,
+}
+
+func (p *parser) augAssignStmt(left astExpr) *augAssignStmt {
+	if !isLeftHand(left) {
+		p.errorAtPrevious("wrong assign target")
+	}
+	p.advance()
+	op := p.previous
+	op.tokenType = augmentedOps[op.tokenType]
+	op.literal = op.literal[:len(op.literal)-1]
+	stmt := &augAssignStmt{
+		position: left.pos(),
+		left:     left,
+		op:       op,
+		right:    p.expr(precLowest),
+	}
+	p.consume(tokenNewLine, "expect new line")
+	return stmt
+}
+
 func (p *parser) expr(prec precedence) astExpr {
 	var left astExpr
 	p.advance()
 	switch p.previous.tokenType {
 	case tokenNone:
-		left = &noneLit{}
+		left = &noneLit{p.pos()}
 	case tokenFalse:
-		left = &boolLit{false}
+		left = &boolLit{p.pos(), false}
 	case tokenTrue:
-		left = &boolLit{true}
+		left = &boolLit{p.pos(), true}
 	case tokenFloat:
-		n, _ := strconv.ParseFloat(p.previous.literal, 64)
-		left = &numLit{n}
+		lit := p.previous.literal
+		if strings.Contains(lit, ".") {
+			n, _ := strconv.ParseFloat(strings.ReplaceAll(lit, "_", ""), 64)
+			left = &numLit{p.pos(), Num(n)}
+		} else {
+			n, _ := parseInt(lit, 10)
+			left = &numLit{p.pos(), n}
+		}
+	case tokenDecimal:
+		lit := p.previous.literal
+		d, _ := ParseDecimal(lit[:len(lit)-1])
+		left = &numLit{p.pos(), d}
 	case tokenInteger:
 		base := integerBases[lowerChar(p.previous.literal[1])]
-		n, _ := strconv.ParseUint(p.previous.literal[2:], base, 64)
-		left = &numLit{float64(n)}
+		n, ok := parseInt(p.previous.literal[2:], base)
+		if !ok {
+			p.errorAtPrevious("invalid integer literal")
+		}
+		left = &numLit{p.pos(), n}
 	case tokenString:
-		left = &strLit{p.previous.literal[1 : len(p.previous.literal)-1]}
+		left = &strLit{p.pos(), p.previous.literal}
+	case tokenFString:
+		left = p.fStrLit()
 	case tokenLambda:
 		left = p.lambdaLit()
 	case tokenIdentifier:
-		left = &ident{p.previous.literal}
-	case tokenMinus, tokenPlus, tokenNot:
+		left = &ident{position: p.pos(), name: p.previous.literal}
+	case tokenMinus, tokenPlus, tokenTilde, tokenNot:
 		left = p.prefixExpr()
 	case tokenLeftParen:
-		left = p.expr(precLowest)
-		p.consume(tokenRightParen, "expect ')'")
+		left = p.group()
 	case tokenLeftBracket:
 		left = p.listLit()
 	case tokenLeftBrace:
@@ -313,15 +424,33 @@ func (p *parser) expr(prec precedence) astExpr {
 		p.errorAtPrevious("expect expression")
 	}
 
+	optional := false // left is a chain with an optional link
 	for prec < precedences[p.current.tokenType] {
 		p.advance()
 		switch p.previous.tokenType {
-		case tokenAnd, tokenOr, tokenEqualEqual, tokenBangEqual,
+		case tokenIf:
+			left = p.condExpr(left)
+		case tokenColonEqual:
+			left = p.walrusExpr(left)
+		case tokenQuestionQuestion:
+			left = &coalesceExpr{p.pos(), left, p.expr(precCoalesce)}
+		case tokenQuestionDot:
+			expr := p.propertyExpr(left)
+			expr.optional, optional = true, true
+			left = expr
+		case tokenQuestionArrow:
+			expr := p.arrowExpr(left)
+			expr.optional, optional = true, true
+			left = expr
+		case tokenAnd, tokenOr,
 			tokenPlus, tokenMinus, tokenStar, tokenSlash, tokenPersent,
 			tokenStarStar, tokenSlashSlash,
-			tokenGreater, tokenGreaterEqual,
-			tokenLess, tokenLessEqual:
+			tokenAmper, tokenPipe, tokenCaret, tokenLessLess, tokenGreaterGreater:
 			left = p.infixExpr(left)
+		case tokenEqualEqual, tokenBangEqual,
+			tokenGreater, tokenGreaterEqual, tokenLess, tokenLessEqual,
+			tokenIn, tokenNot, tokenIs:
+			left = p.compareExpr(left)
 		case tokenDot:
 			left = p.propertyExpr(left)
 		case tokenLeftBracket:
@@ -335,54 +464,126 @@ func (p *parser) expr(prec precedence) astExpr {
 		default:
 			panic("expr: what?")
 		}
+		if optional && precedences[p.current.tokenType] != precCall {
+			left = &optChain{left.pos(), left}
+			optional = false
+		}
 	}
 
 	return left
 }
 
+func (p *parser) fStrLit() *fStrLit {
+	lit := &fStrLit{position: p.pos()}
+	for _, part := range p.previous.parts {
+		if part.expr == nil {
+			if part.text != "" {
+				lit.parts = append(lit.parts, &strLit{lit.position, part.text})
+			}
+			continue
+		}
+		lit.parts = append(lit.parts, &formatExpr{
+			position: position{part.line, part.col},
+			value:    p.fStringExpr(part),
+			conv:     part.conv,
+			spec:     part.spec,
+		})
+	}
+	return lit
+}
+
+// fStringExpr parses the expression of an f-string part with a scanner
+// of its own.
+func (p *parser) fStringExpr(part fPart) astExpr {
+	scanner, current, previous := p.scanner, p.current, p.previous
+	defer func() { p.scanner, p.current, p.previous = scanner, current, previous }()
+	p.scanner = newScanner(part.expr)
+	p.scanner.line = part.line
+	p.scanner.lineStart = 1 - part.col
+	p.scanner.inParens = 1 // new lines don't end the expression
+	p.advance()
+	value := p.expr(precLowest)
+	if !p.check(tokenEof) {
+		p.errorAtCurrent("expect '}' in f-string")
+	}
+	return value
+}
+
+func (p *parser) condExpr(then astExpr) *condExpr {
+	expr := &condExpr{position: p.pos(), then: then}
+	expr.cond = p.expr(precCond)
+	p.consume(tokenElse, "expect 'else'")
+	expr.else_ = p.expr(precWalrus)
+	return expr
+}
+
+func (p *parser) walrusExpr(left astExpr) *walrusExpr {
+	target, ok := left.(*ident)
+	if !ok {
+		p.errorAtPrevious("wrong assign target")
+	}
+	return &walrusExpr{p.pos(), target, p.expr(precLowest)}
+}
+
 func (p *parser) lambdaLit() *lambdaLit {
-	lit := &lambdaLit{defStmt: &defStmt{}}
+	lit := &lambdaLit{defStmt: &defStmt{position: p.pos()}}
 	lit.params = p.lambdaParams()
 	lit.name = "(anonymous)"
-	lit.body = []astStmt{&returnStmt{[]astExpr{p.expr(precLowest)}}}
+	value := p.expr(precLowest)
+	lit.body = []astStmt{&returnStmt{value.pos(), []astExpr{value}}}
 	return lit
 }
 
 func (p *parser) propertyExpr(left astExpr) *indexExpr {
 	expr := &indexExpr{
-		left: left,
+		position: p.pos(),
+		left:     left,
 	}
 	p.consume(tokenIdentifier, "expect property")
-	expr.index = &strLit{p.previous.literal}
+	expr.index = &strLit{p.pos(), p.previous.literal}
 	return expr
 }
 
-func (p *parser) indexExpr(left astExpr) *indexExpr {
-	expr := &indexExpr{
-		left: left,
+func (p *parser) indexExpr(left astExpr) astExpr {
+	pos := p.pos()
+	var index astExpr
+	if !p.check(tokenColon) {
+		index = p.expr(precLowest)
+		if p.match(tokenRightBracket) {
+			return &indexExpr{position: pos, left: left, index: index, item: true}
+		}
+	}
+	p.consume(tokenColon, "expect ']'")
+	expr := &sliceExpr{position: pos, left: left, start: index}
+	if !p.check(tokenColon) && !p.check(tokenRightBracket) {
+		expr.stop = p.expr(precLowest)
+	}
+	if p.match(tokenColon) && !p.check(tokenRightBracket) {
+		expr.step = p.expr(precLowest)
 	}
-	expr.index = p.expr(precLowest)
 	p.consume(tokenRightBracket, "expect ']'")
 	return expr
 }
 
 func (p *parser) arrowExpr(left astExpr) *arrowExpr {
 	expr := &arrowExpr{
-		left: left,
+		position: p.pos(),
+		left:     left,
 	}
 	if p.match(tokenLeftBracket) {
 		expr.index = p.expr(precLowest)
 		p.consume(tokenRightBracket, "expect ']'")
 	} else {
 		p.consume(tokenIdentifier, "expect property name")
-		expr.index = &strLit{p.previous.literal}
+		expr.index = &strLit{p.pos(), p.previous.literal}
 	}
 	return expr
 }
 
 func (p *parser) callExpr(left astExpr) *callExpr {
 	expr := &callExpr{
-		left: left,
+		position: p.pos(),
+		left:     left,
 	}
 	expr.args = p.args()
 	return expr
@@ -390,43 +591,101 @@ func (p *parser) callExpr(left astExpr) *callExpr {
 
 func (p *parser) infixExpr(left astExpr) *infixExpr {
 	expr := &infixExpr{
-		left:    left,
-		opToken: p.previous,
+		position: p.pos(),
+		left:     left,
+		opToken:  p.previous,
+	}
+	prec := precedences[p.previous.tokenType]
+	if prec == precPow {
+		prec-- // right associative
+	}
+	expr.right = p.expr(prec)
+	return expr
+}
+
+// compareExpr parses comparisons, a chain like 'a < b < c' is one
+// compareExpr.
+func (p *parser) compareExpr(left astExpr) astExpr {
+	pos := p.pos()
+	expr := &compareExpr{position: pos, operands: []astExpr{left}}
+	for {
+		op := p.previous
+		switch {
+		case op.tokenType == tokenNot:
+			p.consume(tokenIn, "expect 'in'")
+			op.tokenType, op.literal = tokenNotIn, "not in"
+		case op.tokenType == tokenIs && p.match(tokenNot):
+			op.tokenType, op.literal = tokenIsNot, "is not"
+		}
+		expr.ops = append(expr.ops, op)
+		expr.operands = append(expr.operands, p.expr(precComp))
+		if precedences[p.current.tokenType] != precComp {
+			break
+		}
+		p.advance()
+	}
+	if len(expr.ops) == 1 {
+		return &infixExpr{
+			position: pos,
+			left:     expr.operands[0],
+			right:    expr.operands[1],
+			opToken:  expr.ops[0],
+		}
 	}
-	expr.right = p.expr(precedences[p.previous.tokenType])
 	return expr
 }
 
 func (p *parser) prefixExpr() *prefixExpr {
 	expr := &prefixExpr{
-		opToken: p.previous,
+		position: p.pos(),
+		opToken:  p.previous,
+	}
+	if p.previous.tokenType == tokenNot {
+		expr.right = p.expr(precNot)
+	} else {
+		expr.right = p.expr(precUnary)
 	}
-	expr.right = p.expr(precUnary)
 	return expr
 }
 
 func (p *parser) protoDictExpr(left astExpr) *protoDictExpr {
-	return &protoDictExpr{left, p.dictLit()}
+	pos := p.pos()
+	dict, ok := p.dictLit().(*dictLit)
+	if !ok {
+		p.errorAtPrevious("comprehension can't have a prototype")
+	}
+	return &protoDictExpr{pos, left, dict}
 }
 
-func (p *parser) dictLit() *dictLit {
-	lit := &dictLit{map[astExpr]astExpr{}}
+// dictLit parses a dict literal or a dict comprehension.
+func (p *parser) dictLit() astExpr {
+	lit := &dictLit{position: p.pos()}
 	if p.match(tokenRightBrace) {
 		return lit
 	}
 	for {
 		var key astExpr
+		bare := false // 'k: v' rather than '[k]: v'
 		if p.match(tokenLeftBracket) {
 			key = p.expr(precLowest)
 			p.consume(tokenRightBracket, "expect ']'")
 		} else if p.match(tokenIdentifier) {
-			key = &strLit{p.previous.literal}
+			key, bare = &strLit{p.pos(), p.previous.literal}, true
 		} else {
 			p.errorAtCurrent("expect key")
 		}
 		p.consume(tokenColon, "expect ':'")
 		val := p.expr(precLowest)
-		lit.pairs[key] = val
+		if len(lit.keys) == 0 && p.match(tokenFor) {
+			if bare { // keys of comprehensions are variables
+				key = &ident{position: key.pos(), name: key.(*strLit).value}
+			}
+			comp := p.comprehension(lit.position, compDict, key, val)
+			p.consume(tokenRightBrace, "expect '}'")
+			return comp
+		}
+		lit.keys = append(lit.keys, key)
+		lit.vals = append(lit.vals, val)
 		if !p.match(tokenComma) {
 			break
 		}
@@ -438,13 +697,44 @@ func (p *parser) dictLit() *dictLit {
 	return lit
 }
 
-func (p *parser) listLit() *listLit {
-	lit := &listLit{[]astExpr{}}
+// group parses a parenthesized expression, a tuple: '()', '(a,)' or
+// '(a, b)', or a generator expression.
+func (p *parser) group() astExpr {
+	pos := p.pos()
+	if p.match(tokenRightParen) {
+		return &tupleLit{pos, []astExpr{}}
+	}
+	expr := p.expr(precLowest)
+	if p.match(tokenFor) {
+		comp := p.comprehension(pos, compGen, nil, expr)
+		p.consume(tokenRightParen, "expect ')'")
+		return comp
+	}
+	if !p.check(tokenComma) {
+		p.consume(tokenRightParen, "expect ')'")
+		return expr
+	}
+	lit := &tupleLit{pos, []astExpr{expr}}
+	for p.match(tokenComma) && !p.check(tokenRightParen) {
+		lit.elems = append(lit.elems, p.expr(precLowest))
+	}
+	p.consume(tokenRightParen, "expect ')'")
+	return lit
+}
+
+// listLit parses a list literal or a list comprehension.
+func (p *parser) listLit() astExpr {
+	lit := &listLit{p.pos(), []astExpr{}}
 	if p.match(tokenRightBracket) {
 		return lit
 	}
 	for {
 		lit.elems = append(lit.elems, p.expr(precLowest))
+		if len(lit.elems) == 1 && p.match(tokenFor) {
+			comp := p.comprehension(lit.position, compList, nil, lit.elems[0])
+			p.consume(tokenRightBracket, "expect ']'")
+			return comp
+		}
 		if !p.match(tokenComma) {
 			break
 		}
@@ -456,33 +746,95 @@ func (p *parser) listLit() *listLit {
 	return lit
 }
 
+var compNames = map[compKind]string{
+	compList: "(listcomp)",
+	compDict: "(dictcomp)",
+	compGen:  "(genexpr)",
+}
+
+// comprehension parses the clauses after the first 'for' of a
+// comprehension into nested loops and conditions. The iterable of the
+// first loop is left outside, the loop gets it as the parameter.
+func (p *parser) comprehension(pos position, kind compKind, key, value astExpr) *compExpr {
+	comp := &compExpr{
+		defStmt: &defStmt{position: pos, name: compNames[kind], params: []varName{compIter}},
+		kind:    kind,
+	}
+	body := &comp.body
+	for {
+		loop := &forStmt{position: p.pos(), vars: p.loopVars()}
+		p.consume(tokenIn, "expect 'in'")
+		loop.in = p.expr(precCond)
+		if comp.in == nil {
+			comp.in, loop.in = loop.in, &ident{position: loop.in.pos(), name: compIter}
+		}
+		*body = append(*body, loop)
+		body = &loop.loop
+		for p.match(tokenIf) {
+			cond := &ifStmt{position: p.pos(), cond: p.expr(precCond)}
+			*body = append(*body, cond)
+			body = &cond.then
+		}
+		if !p.match(tokenFor) {
+			break
+		}
+	}
+	*body = append(*body, &compStmt{value.pos(), kind, key, value})
+	return comp
+}
+
 type precedence int
 
 const (
-	precLowest precedence = iota
-	precOr                // or
-	precAnd               // and
-	precEq                // == !=
-	precComp              // < > <= >=
-	precTerm              // + -
-	precFact              // * / // %
-	precUnary             // not - +
-	precCall              // . () {} [] ->
+	precLowest   precedence = iota
+	precWalrus              // :=
+	precCond                // if else
+	precCoalesce            // ??
+	precOr                  // or
+	precAnd                 // and
+	precNot                 // not
+	precComp                // == != < > <= >= in not in is is not
+	precBitOr               // |
+	precBitXor              // ^
+	precBitAnd              // &
+	precShift               // << >>
+	precTerm                // + -
+	precFact                // * / // %
+	precUnary               // - + ~
+	precPow                 // **
+	precCall                // . () {} [] -> ?. ?->
 	precHighest
 )
 
 var precedences = map[tokenType]precedence{
+	tokenColonEqual: precWalrus,
+
+	tokenIf: precCond,
+
+	tokenQuestionQuestion: precCoalesce,
+
 	tokenOr: precOr,
 
 	tokenAnd: precAnd,
 
-	tokenEqualEqual: precEq,
-	tokenBangEqual:  precEq,
-
+	tokenEqualEqual:   precComp,
+	tokenBangEqual:    precComp,
 	tokenGreater:      precComp,
 	tokenGreaterEqual: precComp,
 	tokenLess:         precComp,
 	tokenLessEqual:    precComp,
+	tokenIn:           precComp,
+	tokenNot:          precComp, // not in
+	tokenIs:           precComp,
+
+	tokenPipe: precBitOr,
+
+	tokenCaret: precBitXor,
+
+	tokenAmper: precBitAnd,
+
+	tokenLessLess:       precShift,
+	tokenGreaterGreater: precShift,
 
 	tokenPlus:  precTerm,
 	tokenMinus: precTerm,
@@ -492,15 +844,20 @@ var precedences = map[tokenType]precedence{
 	tokenPersent:    precFact,
 	tokenSlashSlash: precFact,
 
+	tokenStarStar: precPow,
+
 	tokenDot:         precCall,
 	tokenLeftParen:   precCall,
 	tokenLeftBracket: precCall,
 	tokenLeftBrace:   precCall,
 	tokenArrow:       precCall,
+
+	tokenQuestionDot:   precCall,
+	tokenQuestionArrow: precCall,
 }
 
 func (p *parser) whileStmt() *whileStmt {
-	stmt := &whileStmt{}
+	stmt := &whileStmt{position: p.pos()}
 	stmt.cond = p.expr(precLowest)
 	p.loopCtx = &loopCtx{p.loopCtx}
 	stmt.loop = p.block()
@@ -509,14 +866,7 @@ func (p *parser) whileStmt() *whileStmt {
 }
 
 func (p *parser) forStmt() *forStmt {
-	stmt := &forStmt{}
-	for {
-		p.consume(tokenIdentifier, "expect loop variable")
-		stmt.vars = append(stmt.vars, p.previous.literal)
-		if !p.match(tokenComma) {
-			break
-		}
-	}
+	stmt := &forStmt{position: p.pos(), vars: p.loopVars()}
 	p.consume(tokenIn, "expect 'in'")
 	stmt.in = p.expr(precLowest)
 	p.loopCtx = &loopCtx{p.loopCtx}
@@ -525,8 +875,19 @@ func (p *parser) forStmt() *forStmt {
 	return stmt
 }
 
+func (p *parser) loopVars() []varName {
+	vars := []varName{}
+	for {
+		p.consume(tokenIdentifier, "expect loop variable")
+		vars = append(vars, p.previous.literal)
+		if !p.match(tokenComma) {
+			return vars
+		}
+	}
+}
+
 func (p *parser) ifStmt() *ifStmt {
-	stmt := &ifStmt{}
+	stmt := &ifStmt{position: p.pos()}
 	stmt.cond = p.expr(precLowest)
 	stmt.then = p.block()
 	if p.match(tokenElif) {
@@ -540,7 +901,7 @@ func (p *parser) ifStmt() *ifStmt {
 }
 
 func (p *parser) defStmt() *defStmt {
-	stmt := &defStmt{}
+	stmt := &defStmt{position: p.pos()}
 	p.consume(tokenIdentifier, "expect function name")
 	stmt.name = p.previous.literal
 	p.consume(tokenLeftParen, "expect '('")
@@ -552,7 +913,7 @@ func (p *parser) defStmt() *defStmt {
 }
 
 func (p *parser) decoStmt() *decoStmt {
-	stmt := &decoStmt{}
+	stmt := &decoStmt{position: p.pos()}
 	stmt.deco = p.expr(precLowest)
 	p.consume(tokenNewLine, "expect new line")
 	p.consume(tokenDef, "expect 'def'")
@@ -602,6 +963,10 @@ func (p *parser) args() []astExpr {
 	}
 	for {
 		args = append(args, p.expr(precLowest))
+		if len(args) == 1 && p.match(tokenFor) { // 'f(x for x in xs)'
+			args[0] = p.comprehension(args[0].pos(), compGen, nil, args[0])
+			break
+		}
 		if !p.match(tokenComma) {
 			break
 		}
@@ -620,7 +985,8 @@ func (p *parser) synchronize() {
 		}
 		switch p.current.tokenType {
 		case tokenDef, tokenFor, tokenIf, tokenRaise, tokenTry,
-			tokenWhile, tokenBreak, tokenContinue, tokenReturn, tokenExcept:
+			tokenWhile, tokenBreak, tokenContinue, tokenReturn, tokenExcept,
+			tokenImport, tokenFrom:
 			return
 		}
 
@@ -0,0 +1,464 @@
+package yeva
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// varRef is the place a variable was bound to by the resolver: a slot in
+// the env depth functions up, or a slot of the program's globals when
+// depth is globalDepth.
+type varRef struct {
+	depth int
+	slot  int
+}
+
+const globalDepth = -1
+
+func (ref varRef) isGlobal() bool { return ref.depth == globalDepth }
+
+type scope struct {
+	encl   *scope // nil for the main scope
+	locals map[varName]int
+	decls  map[varName]varType
+}
+
+func (s *scope) isMain() bool { return s.encl == nil }
+
+func (s *scope) declare(name varName) {
+	if _, ok := s.locals[name]; !ok {
+		s.locals[name] = len(s.locals)
+	}
+}
+
+type resolver struct {
+	scope   *scope
+	pos     position
+	globals map[varName]int // slots of the globals
+	names   []varName       // globals by slot
+}
+
+// resolve binds every variable of the program to a slot and gives the
+// names of the globals by their slots.
+func resolve(program []astStmt) (globals []varName, err error) {
+	defer catch(func(ce compileError) { err = errors.New(string(ce)) })
+
+	r := &resolver{scope: &scope{}, globals: make(map[varName]int)}
+	r.stmts(program)
+	return r.names, nil
+}
+
+func (r *resolver) error(format string, a ...any) {
+	panic(compileError(r.pos.String() + ": " + fmt.Sprintf(format, a...)))
+}
+
+func (r *resolver) function(def *defStmt) {
+	r.body(def, make(map[varName]varType))
+}
+
+// comprehension resolves the function of a comprehension. Targets of
+// assignment expressions in it bind in the enclosing function, or are
+// globals in the main scope, and can't be loop variables.
+func (r *resolver) comprehension(comp *compExpr) {
+	var vars, targets []varName
+	compTargets(comp.body, &vars, &targets)
+	decls := make(map[varName]varType)
+	for _, name := range targets {
+		if slices.Contains(vars, name) {
+			r.error("assignment expression can't rebind comprehension variable '%s'", name)
+		}
+		if r.lookup(name).isGlobal() {
+			decls[name] = varGlobal
+		} else {
+			decls[name] = varNonLocal
+		}
+	}
+	r.body(comp.defStmt, decls)
+}
+
+// body resolves a function with the declarations it starts with.
+func (r *resolver) body(def *defStmt, decls map[varName]varType) {
+	s := &scope{
+		encl:   r.scope,
+		locals: make(map[varName]int),
+		decls:  decls,
+	}
+	for _, param := range def.params {
+		s.declare(param)
+	}
+	assigned := []varName{}
+	r.collect(s, def.body, &assigned)
+	for _, name := range assigned {
+		if _, ok := s.decls[name]; !ok {
+			s.declare(name)
+		}
+	}
+
+	r.scope = s
+	r.stmts(def.body)
+	r.scope = s.encl
+	def.locals = len(s.locals)
+}
+
+// collect gathers declarations and assigned names of a function body
+// without entering nested functions.
+func (r *resolver) collect(s *scope, stmts []astStmt, assigned *[]varName) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *declStmt:
+			r.pos = stmt.pos()
+			for _, name := range stmt.vars {
+				if t, ok := s.decls[name]; ok && t != stmt.varType {
+					r.error("variable '%s' declared %s and %s", name, t, stmt.varType)
+				}
+				if _, ok := s.locals[name]; ok && stmt.varType != varLocal {
+					r.error("variable '%s' can't be local and %s", name, stmt.varType)
+				}
+				s.decls[name] = stmt.varType
+				switch stmt.varType {
+				case varLocal:
+					s.declare(name)
+				case varNonLocal:
+					if _, ok := r.outer(s.encl, name); !ok {
+						r.error("no binding for nonlocal '%s' found", name)
+					}
+				}
+			}
+		case *exprStmt:
+			walruses(assigned, stmt.expr)
+		case *assignStmt:
+			for _, left := range stmt.lefts {
+				if id, ok := left.(*ident); ok {
+					*assigned = append(*assigned, id.name)
+				}
+			}
+			walruses(assigned, stmt.lefts...)
+			walruses(assigned, stmt.rights...)
+		case *augAssignStmt:
+			if id, ok := stmt.left.(*ident); ok {
+				*assigned = append(*assigned, id.name)
+			}
+			walruses(assigned, stmt.left)
+			walruses(assigned, stmt.right)
+		case *returnStmt:
+			walruses(assigned, stmt.values...)
+		case *raiseStmt:
+			walruses(assigned, stmt.exc)
+		case *compStmt:
+			walruses(assigned, stmt.key, stmt.value)
+		case *defStmt:
+			*assigned = append(*assigned, stmt.name)
+		case *importStmt:
+			*assigned = append(*assigned, stmt.as)
+		case *fromImportStmt:
+			*assigned = append(*assigned, stmt.vars...)
+		case *decoStmt:
+			*assigned = append(*assigned, stmt.def.name)
+			walruses(assigned, stmt.deco)
+		case *forStmt:
+			*assigned = append(*assigned, stmt.vars...)
+			walruses(assigned, stmt.in)
+			r.collect(s, stmt.loop, assigned)
+		case *whileStmt:
+			walruses(assigned, stmt.cond)
+			r.collect(s, stmt.loop, assigned)
+		case *ifStmt:
+			walruses(assigned, stmt.cond)
+			r.collect(s, stmt.then, assigned)
+			r.collect(s, stmt.else_, assigned)
+		case *tryStmt:
+			r.collect(s, stmt.try, assigned)
+			if stmt.except != nil {
+				*assigned = append(*assigned, stmt.as)
+				r.collect(s, stmt.except, assigned)
+			}
+			r.collect(s, stmt.finally, assigned)
+		}
+	}
+}
+
+// walruses gathers the targets of assignment expressions, the ones in
+// lambdas are locals of the lambdas and the ones in comprehensions
+// are gathered with the enclosing function's.
+func walruses(assigned *[]varName, exprs ...astExpr) {
+	for _, node := range exprs {
+		switch node := node.(type) {
+		case *walrusExpr:
+			*assigned = append(*assigned, node.target.name)
+			walruses(assigned, node.value)
+		case *listLit:
+			walruses(assigned, node.elems...)
+		case *tupleLit:
+			walruses(assigned, node.elems...)
+		case *fStrLit:
+			walruses(assigned, node.parts...)
+		case *formatExpr:
+			walruses(assigned, node.value)
+		case *dictLit:
+			walruses(assigned, node.keys...)
+			walruses(assigned, node.vals...)
+		case *protoDictExpr:
+			walruses(assigned, node.proto, node.dict)
+		case *indexExpr:
+			walruses(assigned, node.left, node.index)
+		case *sliceExpr:
+			walruses(assigned, node.left)
+			for _, bound := range []astExpr{node.start, node.stop, node.step} {
+				if bound != nil {
+					walruses(assigned, bound)
+				}
+			}
+		case *arrowExpr:
+			walruses(assigned, node.left, node.index)
+		case *callExpr:
+			walruses(assigned, node.left)
+			walruses(assigned, node.args...)
+		case *prefixExpr:
+			walruses(assigned, node.right)
+		case *compareExpr:
+			walruses(assigned, node.operands...)
+		case *infixExpr:
+			walruses(assigned, node.left, node.right)
+		case *optChain:
+			walruses(assigned, node.expr)
+		case *condExpr:
+			walruses(assigned, node.cond, node.then, node.else_)
+		case *coalesceExpr:
+			walruses(assigned, node.left, node.right)
+		case *compExpr:
+			walruses(assigned, node.in)
+			var vars []varName
+			compTargets(node.body, &vars, assigned)
+		}
+	}
+}
+
+// compTargets gathers the loop variables and the targets of assignment
+// expressions in the loops and conditions of a comprehension.
+func compTargets(stmts []astStmt, vars, targets *[]varName) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *forStmt:
+			*vars = append(*vars, stmt.vars...)
+			walruses(targets, stmt.in)
+			compTargets(stmt.loop, vars, targets)
+		case *ifStmt:
+			walruses(targets, stmt.cond)
+			compTargets(stmt.then, vars, targets)
+		case *compStmt:
+			walruses(targets, stmt.key, stmt.value)
+		}
+	}
+}
+
+func (r *resolver) lookup(name varName) varRef {
+	s := r.scope
+	if s.isMain() {
+		return r.global(name)
+	}
+	switch s.decls[name] {
+	case varGlobal:
+		return r.global(name)
+	case varNonLocal:
+		ref, ok := r.outer(s.encl, name)
+		if !ok {
+			r.error("no binding for nonlocal '%s' found", name)
+		}
+		return ref
+	}
+	if slot, ok := s.locals[name]; ok {
+		return varRef{0, slot}
+	}
+	if ref, ok := r.outer(s.encl, name); ok {
+		return ref
+	}
+	return r.global(name)
+}
+
+// global gives the slot of a global, the first one looked up gets 0.
+func (r *resolver) global(name varName) varRef {
+	slot, ok := r.globals[name]
+	if !ok {
+		slot = len(r.names)
+		r.globals[name] = slot
+		r.names = append(r.names, name)
+	}
+	return varRef{globalDepth, slot}
+}
+
+// outer searches the enclosing functions for a local variable.
+func (r *resolver) outer(s *scope, name varName) (varRef, bool) {
+	for depth := 1; !s.isMain(); depth++ {
+		switch s.decls[name] {
+		case varGlobal:
+			return varRef{}, false
+		case varNonLocal:
+			s = s.encl
+			continue
+		}
+		if slot, ok := s.locals[name]; ok {
+			return varRef{depth, slot}, true
+		}
+		s = s.encl
+	}
+	return varRef{}, false
+}
+
+/* == statements ============================================================ */
+
+func (r *resolver) stmts(stmts []astStmt) {
+	for _, stmt := range stmts {
+		r.stmt(stmt)
+	}
+}
+
+func (r *resolver) stmt(node astStmt) {
+	prev := r.pos
+	r.pos = node.pos()
+	defer func() { r.pos = prev }()
+
+	switch node := node.(type) {
+	case *exprStmt:
+		r.expr(node.expr)
+	case *assignStmt:
+		r.exprs(node.rights)
+		r.exprs(node.lefts)
+	case *augAssignStmt:
+		r.expr(node.right)
+		r.expr(node.left)
+	case *declStmt:
+		if r.scope.isMain() && node.varType == varNonLocal {
+			r.error("nonlocal declaration outside function")
+		}
+	case *defStmt:
+		node.ref = r.lookup(node.name)
+		r.function(node)
+	case *decoStmt:
+		r.expr(node.deco)
+		node.def.ref = r.lookup(node.def.name)
+		r.function(node.def)
+	case *ifStmt:
+		r.expr(node.cond)
+		r.stmts(node.then)
+		r.stmts(node.else_)
+	case *whileStmt:
+		r.expr(node.cond)
+		r.stmts(node.loop)
+	case *forStmt:
+		r.expr(node.in)
+		node.refs = make([]varRef, len(node.vars))
+		for i, name := range node.vars {
+			node.refs[i] = r.lookup(name)
+		}
+		r.stmts(node.loop)
+	case *importStmt:
+		node.ref = r.lookup(node.as)
+	case *fromImportStmt:
+		node.refs = make([]varRef, len(node.vars))
+		for i, name := range node.vars {
+			node.refs[i] = r.lookup(name)
+		}
+	case *returnStmt:
+		r.exprs(node.values)
+	case *raiseStmt:
+		r.expr(node.exc)
+	case *tryStmt:
+		r.stmts(node.try)
+		if node.except != nil {
+			node.asRef = r.lookup(node.as)
+			r.stmts(node.except)
+		}
+		r.stmts(node.finally)
+	case *compStmt:
+		if node.key != nil {
+			r.expr(node.key)
+		}
+		r.expr(node.value)
+	case *breakStmt, *continueStmt:
+	default:
+		panic("resolve: unknown node type")
+	}
+}
+
+/* == expressions =========================================================== */
+
+func (r *resolver) exprs(exprs []astExpr) {
+	for _, expr := range exprs {
+		r.expr(expr)
+	}
+}
+
+func (r *resolver) expr(node astExpr) {
+	prev := r.pos
+	r.pos = node.pos()
+	defer func() { r.pos = prev }()
+
+	switch node := node.(type) {
+	case *ident:
+		node.ref = r.lookup(node.name)
+	case *lambdaLit:
+		r.function(node.defStmt)
+	case *compExpr:
+		r.expr(node.in)
+		r.comprehension(node)
+	case *listLit:
+		r.exprs(node.elems)
+	case *tupleLit:
+		r.exprs(node.elems)
+	case *fStrLit:
+		r.exprs(node.parts)
+	case *formatExpr:
+		r.expr(node.value)
+	case *dictLit:
+		r.pairs(node)
+	case *protoDictExpr:
+		r.expr(node.proto)
+		r.pairs(node.dict)
+	case *indexExpr:
+		r.expr(node.left)
+		r.expr(node.index)
+	case *sliceExpr:
+		r.expr(node.left)
+		for _, bound := range []astExpr{node.start, node.stop, node.step} {
+			if bound != nil {
+				r.expr(bound)
+			}
+		}
+	case *arrowExpr:
+		r.expr(node.left)
+		r.expr(node.index)
+	case *optChain:
+		r.expr(node.expr)
+	case *condExpr:
+		r.expr(node.cond)
+		r.expr(node.then)
+		r.expr(node.else_)
+	case *walrusExpr:
+		r.expr(node.value)
+		r.expr(node.target)
+	case *coalesceExpr:
+		r.expr(node.left)
+		r.expr(node.right)
+	case *callExpr:
+		r.expr(node.left)
+		r.exprs(node.args)
+	case *prefixExpr:
+		r.expr(node.right)
+	case *compareExpr:
+		r.exprs(node.operands)
+	case *infixExpr:
+		r.expr(node.left)
+		r.expr(node.right)
+	case *noneLit, *boolLit, *numLit, *strLit:
+	default:
+		panic("resolve: unknown node type")
+	}
+}
+
+func (r *resolver) pairs(dict *dictLit) {
+	for i, key := range dict.keys {
+		r.expr(key)
+		r.expr(dict.vals[i])
+	}
+}
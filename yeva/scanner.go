@@ -2,7 +2,9 @@ package yeva
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 const eofByte byte = 0
@@ -26,22 +28,48 @@ const (
 	tokenDot          tokenType = "dot"
 	tokenColon        tokenType = "colon"
 	tokenDog          tokenType = "dog"
+	tokenAmper        tokenType = "amper"
+	tokenPipe         tokenType = "pipe"
+	tokenCaret        tokenType = "caret"
+	tokenTilde        tokenType = "tilde"
 	// double
-	tokenBangEqual    tokenType = "bang equal"
-	tokenEqual        tokenType = "equal"
-	tokenEqualEqual   tokenType = "equal equal"
-	tokenGreater      tokenType = "greater"
-	tokenGreaterEqual tokenType = "greater equal"
-	tokenLess         tokenType = "less"
-	tokenLessEqual    tokenType = "less equal"
-	tokenSlashSlash   tokenType = "slash slash"
-	tokenStarStar     tokenType = "star star"
-	tokenArrow        tokenType = "arrow"
+	tokenBangEqual      tokenType = "bang equal"
+	tokenEqual          tokenType = "equal"
+	tokenEqualEqual     tokenType = "equal equal"
+	tokenGreater        tokenType = "greater"
+	tokenGreaterEqual   tokenType = "greater equal"
+	tokenLess           tokenType = "less"
+	tokenLessEqual      tokenType = "less equal"
+	tokenSlashSlash     tokenType = "slash slash"
+	tokenStarStar       tokenType = "star star"
+	tokenLessLess       tokenType = "less less"
+	tokenGreaterGreater tokenType = "greater greater"
+	tokenArrow          tokenType = "arrow"
+	tokenColonEqual     tokenType = "colon equal"
+	// optional chaining and coalescing
+	tokenQuestionDot      tokenType = "question dot"
+	tokenQuestionArrow    tokenType = "question arrow"
+	tokenQuestionQuestion tokenType = "question question"
+	// augmented assignment
+	tokenPlusEqual           tokenType = "plus equal"
+	tokenMinusEqual          tokenType = "minus equal"
+	tokenStarEqual           tokenType = "star equal"
+	tokenSlashEqual          tokenType = "slash equal"
+	tokenPersentEqual        tokenType = "persent equal"
+	tokenSlashSlashEqual     tokenType = "slash slash equal"
+	tokenStarStarEqual       tokenType = "star star equal"
+	tokenAmperEqual          tokenType = "amper equal"
+	tokenPipeEqual           tokenType = "pipe equal"
+	tokenCaretEqual          tokenType = "caret equal"
+	tokenLessLessEqual       tokenType = "less less equal"
+	tokenGreaterGreaterEqual tokenType = "greater greater equal"
 	// special
 	tokenIdentifier tokenType = "identifier"
 	tokenString     tokenType = "string"
+	tokenFString    tokenType = "f-string"
 	tokenFloat      tokenType = "float"
 	tokenInteger    tokenType = "integer"
+	tokenDecimal    tokenType = "decimal"
 	// keywords
 	tokenBreak    tokenType = "break"
 	tokenContinue tokenType = "continue"
@@ -63,12 +91,18 @@ const (
 	tokenLocal    tokenType = "local"
 	tokenGlobal   tokenType = "global"
 	tokenIn       tokenType = "in"
+	tokenIs       tokenType = "is"
 	tokenRaise    tokenType = "raise"
 	tokenTry      tokenType = "try"
 	tokenExcept   tokenType = "except"
 	tokenFinally  tokenType = "finally"
 	tokenAs       tokenType = "as"
 	tokenLambda   tokenType = "lambda"
+	tokenImport   tokenType = "import"
+	tokenFrom     tokenType = "from"
+	// made of two keywords by the parser
+	tokenNotIn tokenType = "not in"
+	tokenIsNot tokenType = "is not"
 
 	tokenNewLine tokenType = "new line"
 	tokenIntab   tokenType = "intab"
@@ -81,13 +115,26 @@ const (
 type token struct {
 	tokenType
 	line    int
+	col     int
 	literal string
+	parts   []fPart // of an f-string
+}
+
+// fPart is a part of an f-string, text or the source of an expression
+// with its conversion and format spec.
+type fPart struct {
+	text      string
+	expr      []byte // nil for text
+	line, col int
+	conv      byte // 'r', 's' or 0
+	spec      string
 }
 
 func (t token) String() string {
 	return fmt.Sprintf(
-		"%04d %-12s '%s'",
+		"%04d:%-3d %-12s '%s'",
 		t.line,
+		t.col,
 		t.tokenType,
 		shortString(t.literal, 32, true),
 	)
@@ -104,14 +151,17 @@ const (
 )
 
 type scanner struct {
-	source   []byte
-	sp       int // source pointer
-	start    int
-	line     int
-	newLine  bool
-	inParens int
-	tabs     []int
-	curTab   int
+	source    []byte
+	sp        int // source pointer
+	start     int
+	line      int
+	lineStart int // source pointer of the current line
+	startLine int
+	startCol  int
+	newLine   bool
+	inParens  int
+	tabs      []int
+	curTab    int
 	tabType
 }
 
@@ -132,6 +182,8 @@ func (s *scanner) scanToken() token {
 	s.skipWhitespace()
 
 	s.start = s.sp
+	s.startLine = s.line
+	s.startCol = s.sp - s.lineStart + 1
 
 	if s.newLine && (startLine < s.line || s.isAtEnd()) && s.inParens == 0 {
 		return s.makeToken(tokenNewLine)
@@ -167,6 +219,9 @@ func (s *scanner) scanToken() token {
 	char := s.advance()
 
 	if isAlpha(char) {
+		if tk, ok := s.prefixedString(); ok {
+			return tk
+		}
 		return s.identifier()
 	}
 	if isDigit(char) {
@@ -204,37 +259,56 @@ func (s *scanner) scanToken() token {
 	case ',':
 		return s.makeToken(tokenComma)
 	case '-':
-		t := tokenMinus
 		if s.match('>') {
-			t = tokenArrow
+			return s.makeToken(tokenArrow)
 		}
-		return s.makeToken(t)
+		return s.augmented(tokenMinus, tokenMinusEqual)
 	case '+':
-		return s.makeToken(tokenPlus)
+		return s.augmented(tokenPlus, tokenPlusEqual)
 	case ':':
+		if s.match('=') {
+			return s.makeToken(tokenColonEqual)
+		}
 		return s.makeToken(tokenColon)
+	case '?':
+		switch {
+		case s.match('?'):
+			return s.makeToken(tokenQuestionQuestion)
+		case s.match('.'):
+			return s.makeToken(tokenQuestionDot)
+		case s.current() == '-' && s.peek() == '>':
+			s.advance()
+			s.advance()
+			return s.makeToken(tokenQuestionArrow)
+		}
 	case '%':
-		return s.makeToken(tokenPersent)
+		return s.augmented(tokenPersent, tokenPersentEqual)
 	case '.':
 		return s.makeToken(tokenDot)
 	case '@':
 		return s.makeToken(tokenDog)
+	case '&':
+		return s.augmented(tokenAmper, tokenAmperEqual)
+	case '|':
+		return s.augmented(tokenPipe, tokenPipeEqual)
+	case '^':
+		return s.augmented(tokenCaret, tokenCaretEqual)
+	case '~':
+		return s.makeToken(tokenTilde)
 	case '!':
 		if s.match('=') {
 			return s.makeToken(tokenBangEqual)
 		}
 	case '/':
-		t := tokenSlash
 		if s.match('/') {
-			t = tokenSlashSlash
+			return s.augmented(tokenSlashSlash, tokenSlashSlashEqual)
 		}
-		return s.makeToken(t)
+		return s.augmented(tokenSlash, tokenSlashEqual)
 	case '*':
-		t := tokenStar
 		if s.match('*') {
-			t = tokenStarStar
+			return s.augmented(tokenStarStar, tokenStarStarEqual)
 		}
-		return s.makeToken(t)
+		return s.augmented(tokenStar, tokenStarEqual)
 	case '=':
 		t := tokenEqual
 		if s.match('=') {
@@ -242,19 +316,25 @@ func (s *scanner) scanToken() token {
 		}
 		return s.makeToken(t)
 	case '<':
+		if s.match('<') {
+			return s.augmented(tokenLessLess, tokenLessLessEqual)
+		}
 		t := tokenLess
 		if s.match('=') {
 			t = tokenLessEqual
 		}
 		return s.makeToken(t)
 	case '>':
+		if s.match('>') {
+			return s.augmented(tokenGreaterGreater, tokenGreaterGreaterEqual)
+		}
 		t := tokenGreater
 		if s.match('=') {
 			t = tokenGreaterEqual
 		}
 		return s.makeToken(t)
-	case '"':
-		return s.string()
+	case '"', '\'':
+		return s.string(char, false, false)
 	}
 	return s.errorToken("Unexpected character.")
 }
@@ -306,8 +386,12 @@ func (s *scanner) match(expect byte) bool {
 }
 
 func (s *scanner) makeToken(t tokenType) token {
+	return s.literalToken(t, string(s.source[s.start:s.sp]))
+}
+
+func (s *scanner) literalToken(t tokenType, literal string) token {
 	switch t {
-	case tokenIdentifier, tokenFloat, tokenInteger, tokenString,
+	case tokenIdentifier, tokenFloat, tokenInteger, tokenDecimal, tokenString, tokenFString,
 		tokenNone, tokenFalse, tokenTrue,
 		tokenBreak, tokenContinue, tokenReturn,
 		tokenRightParen, tokenRightBracket, tokenRightBrace,
@@ -316,27 +400,26 @@ func (s *scanner) makeToken(t tokenType) token {
 	default:
 		s.newLine = false
 	}
-	var literal string
-	if t == tokenString {
-		if l, ok := escapeString(s.source[s.start:s.sp]); !ok {
-			return s.errorToken("Invalid escape sequence.")
-		} else {
-			literal = l
-		}
-	} else {
-		literal = string(s.source[s.start:s.sp])
-	}
-	tk := token{t, s.line, literal}
+	tk := token{tokenType: t, line: s.startLine, col: s.startCol, literal: literal}
 	if debugPrintTokens {
 		fmt.Println(tk)
 	}
 	return tk
 }
 
+// augmented makes the token t, or aug when '=' follows.
+func (s *scanner) augmented(t, aug tokenType) token {
+	if s.match('=') {
+		t = aug
+	}
+	return s.makeToken(t)
+}
+
 func (s *scanner) errorToken(message string) token {
 	return token{
 		tokenType: tokenError,
-		line:      s.line,
+		line:      s.startLine,
+		col:       s.startCol,
 		literal:   message,
 	}
 }
@@ -366,6 +449,7 @@ func (s *scanner) skipWhitespace() {
 			tab = 0
 			s.line++
 			s.advance()
+			s.lineStart = s.sp
 		case '#':
 			for s.current() != '\n' && !s.isAtEnd() {
 				s.advance()
@@ -409,6 +493,10 @@ func (s *scanner) float() token {
 		}
 		return s.errorToken("Number literal ends with underscore.")
 	}
+	if s.current() == 'd' && !isAlpha(s.peek()) && !isDigit(s.peek()) {
+		s.advance()
+		return s.makeToken(tokenDecimal)
+	}
 	return s.makeToken(tokenFloat)
 }
 
@@ -430,18 +518,230 @@ func (s *scanner) integer(base int) token {
 	return s.makeToken(tokenInteger)
 }
 
-func (s *scanner) string() token {
-	for !(s.current() == '"' && s.previous() != '\\') && !s.isAtEnd() {
-		if s.current() == '\n' {
-			s.line++
+// prefixedString scans a string with an 'r', 'f', 'rf' or 'fr' prefix
+// in any case, ok is false for an identifier.
+func (s *scanner) prefixedString() (tk token, ok bool) {
+	var raw, format bool
+	i := s.start
+	for ; i < len(s.source) && i-s.start < 2; i++ {
+		if c := lowerChar(s.source[i]); c == 'r' && !raw {
+			raw = true
+		} else if c == 'f' && !format {
+			format = true
+		} else {
+			break
 		}
+	}
+	if i == s.start || i >= len(s.source) || s.source[i] != '"' && s.source[i] != '\'' {
+		return token{}, false
+	}
+	s.sp = i + 1
+	return s.string(s.source[i], raw, format), true
+}
+
+// string scans a string after its opening quote. Strings opened with
+// three quotes end with three and may span lines, raw strings keep
+// backslashes as they are and f-strings are split into parts at '{...}'.
+func (s *scanner) string(quote byte, raw, format bool) token {
+	triple := s.current() == quote && s.peek() == quote
+	if triple {
+		s.advance()
 		s.advance()
 	}
-	if s.isAtEnd() {
-		return s.errorToken("Unterminated string.")
+	var value strings.Builder
+	var parts []fPart
+	for !s.closes(quote, triple) {
+		if s.isAtEnd() {
+			return s.errorToken("Unterminated string.")
+		}
+		char := s.advance()
+		switch {
+		case char == '\n':
+			s.line++
+			s.lineStart = s.sp
+		case format && (char == '{' || char == '}'):
+			if s.match(char) {
+				break // '{{' and '}}' are literal braces
+			}
+			if char == '}' {
+				return s.errorAt(s.line, s.sp-s.lineStart, "Single '}' in f-string.")
+			}
+			part, tk, ok := s.fExpr(quote, triple)
+			if !ok {
+				return tk
+			}
+			parts = append(parts, fPart{text: value.String()}, part)
+			value.Reset()
+			continue
+		case char == '\\' && raw:
+			if s.current() == quote || s.current() == '\\' {
+				value.WriteByte(char)
+				char = s.advance()
+			}
+		case char == '\\':
+			if tk, ok := s.escape(&value); !ok {
+				return tk
+			}
+			continue
+		}
+		value.WriteByte(char)
 	}
 	s.advance()
-	return s.makeToken(tokenString)
+	if triple {
+		s.advance()
+		s.advance()
+	}
+	if !format {
+		return s.literalToken(tokenString, value.String())
+	}
+	tk := s.literalToken(tokenFString, string(s.source[s.start:s.sp]))
+	tk.parts = append(parts, fPart{text: value.String()})
+	return tk
+}
+
+// closes reports whether the closing quotes of a string are next.
+func (s *scanner) closes(quote byte, triple bool) bool {
+	if s.current() != quote {
+		return false
+	}
+	return !triple || s.peek() == quote && s.sp+2 < len(s.source) && s.source[s.sp+2] == quote
+}
+
+// fExpr scans an expression of an f-string after its '{'.
+func (s *scanner) fExpr(quote byte, triple bool) (fPart, token, bool) {
+	part := fPart{line: s.line, col: s.sp - s.lineStart + 1}
+	start, end := s.sp, -1
+	depth := 0
+	spec := false
+	for end < 0 {
+		if s.isAtEnd() || s.closes(quote, triple) || s.current() == '\n' && !triple {
+			return fPart{}, s.errorAt(part.line, part.col-1, "Expect '}' in f-string."), false
+		}
+		char := s.advance()
+		switch char {
+		case '\n':
+			s.line++
+			s.lineStart = s.sp
+		case '(', '[', '{':
+			depth++
+		case ')', ']':
+			depth--
+		case '}':
+			if depth == 0 {
+				end = s.sp - 1
+			}
+			depth--
+		case ':':
+			if depth == 0 {
+				end, spec = s.sp-1, true
+			}
+		case '!':
+			if depth == 0 && strings.IndexByte("rs", s.current()) >= 0 &&
+				(s.peek() == '}' || s.peek() == ':') {
+				end = s.sp - 1
+				part.conv = s.advance()
+				spec = s.advance() == ':'
+			}
+		case '"', '\'':
+			for !s.match(char) {
+				if s.isAtEnd() || s.current() == '\n' {
+					return fPart{}, s.errorToken("Unterminated string."), false
+				}
+				if s.advance() == '\\' {
+					s.advance()
+				}
+			}
+		}
+	}
+	part.expr = s.source[start:end]
+	if len(strings.TrimSpace(string(part.expr))) == 0 {
+		return fPart{}, s.errorAt(part.line, part.col, "Empty expression in f-string."), false
+	}
+	if spec {
+		start := s.sp
+		for !s.match('}') {
+			if s.isAtEnd() || s.closes(quote, triple) || s.current() == '\n' {
+				return fPart{}, s.errorAt(part.line, part.col-1, "Expect '}' in f-string."), false
+			}
+			if s.advance() == '{' {
+				return fPart{}, s.errorAt(s.line, s.sp-s.lineStart, "Nested fields in f-string format specs aren't supported."), false
+			}
+		}
+		part.spec = string(s.source[start : s.sp-1])
+	}
+	return part, token{}, true
+}
+
+// escape writes the character of the escape sequence after a backslash.
+func (s *scanner) escape(value *strings.Builder) (token, bool) {
+	col := s.sp - s.lineStart
+	char := s.advance()
+	switch char {
+	case 'n':
+		value.WriteByte('\n')
+	case 'r':
+		value.WriteByte('\r')
+	case 't':
+		value.WriteByte('\t')
+	case 'b':
+		value.WriteByte('\b')
+	case 'a':
+		value.WriteByte('\a')
+	case 'f':
+		value.WriteByte('\f')
+	case 'v':
+		value.WriteByte('\v')
+	case '0':
+		value.WriteByte(0)
+	case '\n': // the string goes on on the next line
+		s.line++
+		s.lineStart = s.sp
+	case '\\', '"', '\'':
+		value.WriteByte(char)
+	case 'x':
+		start := s.sp
+		for range 2 {
+			if !isHex(s.current()) {
+				return s.errorAt(s.line, col, "'\\x' must be followed by 2 hex digits."), false
+			}
+			s.advance()
+		}
+		n, _ := strconv.ParseUint(string(s.source[start:s.sp]), 16, 8)
+		value.WriteRune(rune(n))
+	case 'u':
+		if !s.match('{') {
+			return s.errorAt(s.line, col, "'\\u' must be followed by '{'."), false
+		}
+		start := s.sp
+		for isHex(s.current()) {
+			s.advance()
+		}
+		digits := string(s.source[start:s.sp])
+		if !s.match('}') || len(digits) == 0 || len(digits) > 6 {
+			return s.errorAt(s.line, col, "'\\u{...}' must have 1 to 6 hex digits."), false
+		}
+		n, _ := strconv.ParseUint(digits, 16, 32)
+		if !utf8.ValidRune(rune(n)) {
+			return s.errorAt(s.line, col, fmt.Sprintf("Invalid code point U+%s.", strings.ToUpper(digits))), false
+		}
+		value.WriteRune(rune(n))
+	default:
+		if s.sp > len(s.source) {
+			return s.errorAt(s.line, col, "Unterminated string."), false
+		}
+		return s.errorAt(s.line, col, fmt.Sprintf("Unknown escape sequence '\\%c'.", char)), false
+	}
+	return token{}, true
+}
+
+// errorAt is errorToken at a position inside the token.
+func (s *scanner) errorAt(line, col int, message string) token {
+	return token{
+		tokenType: tokenError,
+		line:      line,
+		col:       col,
+		literal:   message,
+	}
 }
 
 func isAlpha(char byte) bool {
@@ -458,38 +758,6 @@ func isHex(char byte) bool {
 	return isDigit(char) || 'a' <= lowerChar(char) && lowerChar(char) <= 'f'
 }
 
-func escapeString(source []byte) (string, bool) {
-	var result strings.Builder
-	for i := 0; i < len(source); i++ {
-		b := source[i]
-		if b == '\\' {
-			if i+1 == len(source) {
-				return "", false
-			}
-			switch source[i+1] {
-			case 'n':
-				result.WriteByte('\n')
-			case 'r':
-				result.WriteByte('\r')
-			case 't':
-				result.WriteByte('\t')
-			case 'b':
-				result.WriteByte('\b')
-			case '\\':
-				result.WriteByte('\\')
-			case '"':
-				result.WriteByte('"')
-			default:
-				return "", false
-			}
-			i++
-			continue
-		}
-		result.WriteByte(b)
-	}
-	return result.String(), true
-}
-
 var keywords = map[string]tokenType{
 	"and":      tokenAnd,
 	"else":     tokenElse,
@@ -510,6 +778,7 @@ var keywords = map[string]tokenType{
 	"local":    tokenLocal,
 	"global":   tokenGlobal,
 	"in":       tokenIn,
+	"is":       tokenIs,
 	"raise":    tokenRaise,
 	"try":      tokenTry,
 	"except":   tokenExcept,
@@ -517,4 +786,6 @@ var keywords = map[string]tokenType{
 	"as":       tokenAs,
 	"pass":     tokenPass,
 	"lambda":   tokenLambda,
+	"import":   tokenImport,
+	"from":     tokenFrom,
 }
@@ -0,0 +1,137 @@
+package yeva
+
+import (
+	"math"
+	"slices"
+)
+
+// getSlice gives 'v[start:stop:step]' of a list, a tuple, a string or a
+// box with a Slice hook.
+func (e *Evaluator) getSlice(v, start, stop, step Value) Value {
+	switch v := v.(type) {
+	case *Array:
+		elems := sliceOf(v.Elems, start, stop, step)
+		e.alloc(len(elems) * valueSize)
+		return &Array{Elems: elems}
+	case *Tuple:
+		elems := sliceOf(v.Elems, start, stop, step)
+		e.alloc(len(elems) * valueSize)
+		return &Tuple{Elems: elems}
+	case Str:
+		res := string(sliceOf([]rune(v), start, stop, step))
+		e.alloc(len(res))
+		return Str(res)
+	case *Box:
+		if v.Slice != nil {
+			return v.Slice(start, stop, step)
+		}
+	}
+	Raise(newError("TypeError", "%s can't be sliced", typeName(v)))
+	return nil
+}
+
+// setSlice replaces 'v[start:stop:step]' of a list with the values of
+// an iterable. Simple slices may change the length of the list, the
+// others need as many values as they have elements.
+func (e *Evaluator) setSlice(v, start, stop, step, val Value) {
+	arr, ok := v.(*Array)
+	if !ok {
+		Raise(newError("TypeError", "%s doesn't support slice assignment", typeName(v)))
+	}
+	var vals []Value
+	next := e.iterate(val)
+	for {
+		vs, ok := next()
+		if !ok {
+			break
+		}
+		vals = append(vals, first(vs))
+	}
+	lo, hi, st, n := sliceIndices(len(arr.Elems), start, stop, step)
+	if st == 1 {
+		hi = max(hi, lo)
+		if grow := len(vals) - (hi - lo); grow > 0 {
+			e.alloc(grow * valueSize)
+		}
+		arr.Elems = slices.Replace(arr.Elems, lo, hi, vals...)
+		return
+	}
+	if len(vals) != n {
+		Raise(newError("ValueError", "can't assign %d values to a slice of %d elements",
+			len(vals), n))
+	}
+	for i, val := range vals {
+		arr.Elems[lo+i*st] = val
+	}
+}
+
+func sliceOf[T any](elems []T, start, stop, step Value) []T {
+	lo, _, st, n := sliceIndices(len(elems), start, stop, step)
+	res := make([]T, n)
+	for i := range res {
+		res[i] = elems[lo+i*st]
+	}
+	return res
+}
+
+// sliceIndices gives the first index, the index to stop at, the step
+// and the number of elements of a slice of a sequence of length
+// elements. Bounds out of range are clamped like in Python.
+func sliceIndices(length int, start, stop, step Value) (lo, hi, st, n int) {
+	st = 1
+	if !isNone(step) {
+		st = sliceBound(step)
+		if st == 0 {
+			Raise(newError("ValueError", "slice step can't be zero"))
+		}
+	}
+	lo, hi = 0, length
+	if st < 0 {
+		lo, hi = length-1, -1
+	}
+	clamp := func(i int) int {
+		if i < 0 {
+			i += length
+		}
+		switch {
+		case i < 0 && st < 0:
+			return -1
+		case i < 0:
+			return 0
+		case i >= length && st < 0:
+			return length - 1
+		case i >= length:
+			return length
+		}
+		return i
+	}
+	if !isNone(start) {
+		lo = clamp(sliceBound(start))
+	}
+	if !isNone(stop) {
+		hi = clamp(sliceBound(stop))
+	}
+	switch {
+	case st > 0 && hi > lo:
+		n = (hi-lo-1)/st + 1
+	case st < 0 && lo > hi:
+		n = (lo-hi-1)/-st + 1
+	}
+	return lo, hi, st, n
+}
+
+// sliceBound gives a slice bound as an int, integers too big for int
+// give math.MaxInt or math.MinInt.
+func sliceBound(v Value) int {
+	if b, ok := v.(BigInt); ok {
+		if b.v.Sign() < 0 {
+			return math.MinInt
+		}
+		return math.MaxInt
+	}
+	i, ok := toIndex(v)
+	if !ok {
+		Raise(newError("TypeError", "slice indices must be integers or None, not %s", typeName(v)))
+	}
+	return i
+}
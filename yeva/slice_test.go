@@ -0,0 +1,32 @@
+package yeva
+
+import "testing"
+
+func TestSlice(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"list", `x = [0, 1, 2, 3, 4][1:3]`, "[1, 2]"},
+		{"omitted bounds", `x = [[0, 1, 2][:2], [0, 1, 2][1:]]`, "[[0, 1], [1, 2]]"},
+		{"negative", `x = [0, 1, 2, 3][-3:-1]`, "[1, 2]"},
+		{"step", `x = [0, 1, 2, 3, 4][::-2]`, "[4, 2, 0]"},
+		{"string", `x = "héllo"[1:4]`, `"éll"`},
+		{"tuple", `x = (1, 2, 3)[1:]`, "(2, 3)"},
+		{"assignment", `
+x = [0, 1, 2, 3]
+x[1:3] = ["a", "b", "c"]
+`, `[0, "a", "b", "c", 3]`},
+		{"extended assignment", `
+x = [0, 1, 2, 3]
+x[::2] = [8, 9]
+`, "[8, 1, 9, 3]"},
+	})
+
+	for _, source := range []string{
+		`x = [1, 2][::0]`,
+		"x = [0, 1, 2, 3]\nx[::2] = [1]\n",
+		"x = (1, 2)\nx[0:1] = [3]\n",
+	} {
+		if err := New().Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%q) didn't fail", source)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package yeva
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Index gives the character at a rune index or a method of protoString.
+func (v Str) Index(key Value) Value {
+	if isNumber(key) {
+		s := string(v)
+		for i := checkIndex("string", key, utf8.RuneCountInString(s)); i > 0; i-- {
+			_, size := utf8.DecodeRuneInString(s)
+			s = s[size:]
+		}
+		_, size := utf8.DecodeRuneInString(s)
+		return Str(s[:size])
+	}
+	return protoString.Index(key)
+}
+
+func (v Str) Prototype() *Prototype {
+	return &protoString
+}
+
+var protoString Prototype = protoOf(map[Value]Value{
+	Str("length"): strMethod("length", func(s string) int {
+		return utf8.RuneCountInString(s)
+	}),
+	Str("split"): strMethod("split", func(e *Evaluator, s string, sep ...string) ([]string, error) {
+		var parts []string
+		switch len(sep) {
+		case 0:
+			parts = strings.Fields(s)
+		case 1:
+			if sep[0] == "" {
+				return nil, newError("ValueError", "empty separator")
+			}
+			parts = strings.Split(s, sep[0])
+		default:
+			return nil, newError("TypeError", "split() takes at most 1 argument")
+		}
+		e.alloc(len(parts) * valueSize)
+		return parts, nil
+	}),
+	Str("join"): strMethod("join", func(e *Evaluator, sep string, parts []string) string {
+		res := strings.Join(parts, sep)
+		e.alloc(len(res))
+		return res
+	}),
+	Str("find"): strMethod("find", func(s, sub string) int {
+		i := strings.Index(s, sub)
+		if i < 0 {
+			return -1
+		}
+		return utf8.RuneCountInString(s[:i])
+	}),
+	Str("replace"): strMethod("replace", func(e *Evaluator, s, old, new string, count ...int) (string, error) {
+		n := -1
+		switch len(count) {
+		case 0:
+		case 1:
+			n = count[0]
+		default:
+			return "", newError("TypeError", "replace() takes at most 3 arguments")
+		}
+		res := strings.Replace(s, old, new, n)
+		e.alloc(len(res))
+		return res, nil
+	}),
+	Str("strip"): strMethod("strip", func(s string, chars ...string) string {
+		if len(chars) == 0 {
+			return strings.TrimSpace(s)
+		}
+		return strings.Trim(s, strings.Join(chars, ""))
+	}),
+	Str("lstrip"): strMethod("lstrip", func(s string, chars ...string) string {
+		if len(chars) == 0 {
+			return strings.TrimLeftFunc(s, isSpace)
+		}
+		return strings.TrimLeft(s, strings.Join(chars, ""))
+	}),
+	Str("rstrip"): strMethod("rstrip", func(s string, chars ...string) string {
+		if len(chars) == 0 {
+			return strings.TrimRightFunc(s, isSpace)
+		}
+		return strings.TrimRight(s, strings.Join(chars, ""))
+	}),
+	Str("startswith"): strMethod("startswith", strings.HasPrefix),
+	Str("endswith"):   strMethod("endswith", strings.HasSuffix),
+	Str("upper"):      strMethod("upper", strings.ToUpper),
+	Str("lower"):      strMethod("lower", strings.ToLower),
+	Str("repeat"): strMethod("repeat", func(e *Evaluator, s string, n int) (string, error) {
+		if n < 0 {
+			return "", newError("ValueError", "negative repeat count")
+		}
+		if n > 0 && len(s) > math.MaxInt/n {
+			return "", newError("MemoryError", "repeated string is too long")
+		}
+		e.alloc(len(s) * n)
+		return strings.Repeat(s, n), nil
+	}),
+	Str("format"): strMethod("format", func(e *Evaluator, s string, args ...Value) (string, error) {
+		res, err := formatStr(e, s, args)
+		if err != nil {
+			return "", err
+		}
+		e.alloc(len(res))
+		return res, nil
+	}),
+})
+
+func strMethod(name string, fn any) *NativeFunc {
+	return wrapMethod(name, "a Str", isStr, fn)
+}
+
+func isStr(v Value) bool {
+	_, ok := v.(Str)
+	return ok
+}
+
+func isSpace(r rune) bool {
+	return strings.ContainsRune(" \t\n\r\v\f", r)
+}
+
+// formatStr replaces '{}' with the next argument, '{n}' with the argument
+// n and '{name}' with a key of the only argument. '{{' and '}}' are
+// literal braces.
+func formatStr(e *Evaluator, s string, args []Value) (string, error) {
+	res := &strings.Builder{}
+	next := 0
+	for len(s) > 0 {
+		i := strings.IndexAny(s, "{}")
+		if i < 0 {
+			res.WriteString(s)
+			break
+		}
+		res.WriteString(s[:i])
+		if i+1 < len(s) && s[i+1] == s[i] {
+			res.WriteByte(s[i])
+			s = s[i+2:]
+			continue
+		}
+		if s[i] == '}' {
+			return "", newError("ValueError", "single '}' in format string")
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", newError("ValueError", "single '{' in format string")
+		}
+		field := s[i+1 : i+end]
+		s = s[i+end+1:]
+
+		var arg Value
+		if field == "" {
+			if next >= len(args) {
+				return "", newError("IndexError", "format index %d out of range", next)
+			}
+			arg = args[next]
+			next++
+		} else if n, err := strconv.Atoi(field); err == nil {
+			if n < 0 || n >= len(args) {
+				return "", newError("IndexError", "format index %d out of range", n)
+			}
+			arg = args[n]
+		} else {
+			var doc Prototype
+			if len(args) == 1 {
+				doc, _ = args[0].(Prototype)
+			}
+			if doc == nil {
+				return "", newError("KeyError", "format key '%s' needs one doc argument", field)
+			}
+			arg = doc.Index(Str(field))
+		}
+		res.WriteString(e.toStr(arg))
+	}
+	return res.String(), nil
+}
@@ -0,0 +1,81 @@
+package yeva
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStrMethods(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"split", `x = "a,b,c"->split(",")`, `["a", "b", "c"]`},
+		{"split fields", `x = " a  b "->split()`, `["a", "b"]`},
+		{"join", `x = "-"->join(["a", "b"])`, `"a-b"`},
+		{"find", `x = ["héllo"->find("l"), "abc"->find("z")]`, "[2, -1]"},
+		{"replace", `x = "aXbX"->replace("X", "-")`, `"a-b-"`},
+		{"strip", `x = "  a  "->strip()`, `"a"`},
+		{"startswith", `x = ["abc"->startswith("ab"), "abc"->endswith("ab")]`, "[True, False]"},
+		{"case", `x = "Ab"->upper() + "Ab"->lower()`, `"ABab"`},
+		{"repeat", `x = "ab"->repeat(3)`, `"ababab"`},
+		{"format", `x = "{} {1} {0}"->format("a", "b")`, `"a b a"`},
+		{"format keys", `x = "{name} is {age}"->format({name: "Yeva", age: 3})`, `"Yeva is 3"`},
+		{"length", `x = "héllo"->length()`, "5"},
+		{"index", `x = "héllo"[1]`, `"é"`},
+		{"negative index", `x = ["héllo"[-1], "héllo"[-4], [1, 2, 3][-1]]`, `["o", "é", 3]`},
+	})
+}
+
+func TestStrLiterals(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"single quotes", `x = 'a"b'`, `"a\"b"`},
+		{"escapes", `x = "\x41\u{1F600}\0\t"`, `"A😀\x00\t"`},
+		{"raw", `x = r"a\nb"`, `"a\\nb"`},
+		{"triple quoted", "if True:\n    x = \"\"\"a\n  b\"\"\"\n", `"a\n  b"`},
+	})
+
+	for _, source := range []string{`x = "\q"`, `x = "\u{110000}"`, `x = "\x4"`} {
+		if err := New().Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%s) didn't fail", source)
+		}
+	}
+}
+
+func TestFString(t *testing.T) {
+	runScriptTests(t, []scriptTest{
+		{"interpolation", `
+name = "Yeva"
+age = 2
+x = f"Hello {name}, you are {age + 1}"
+`, `"Hello Yeva, you are 3"`},
+		{"spec", `x = f"{3.14159:.2f}|{42:>5}|{255:x}"`, `"3.14|   42|ff"`},
+		{"repr", `x = f"{'a'!r}"`, `"\"a\""`},
+		{"braces", `x = f"{{{1}}}"`, `"{1}"`},
+		{"decimal", `x = f"{1.10d + 2.205d}"`, `"3.305"`},
+	})
+
+	for _, source := range []string{`x = f"{"`, `x = f"{1!q}"`, `x = f"}"`} {
+		if err := New().Interpret([]byte(source)); err == nil {
+			t.Errorf("Interpret(%s) didn't fail", source)
+		}
+	}
+}
+
+func TestStrErrors(t *testing.T) {
+	for _, tt := range []struct{ source, name string }{
+		{`x = "abc"[3]`, "IndexError"},
+		{`x = "abc"[-4]`, "IndexError"},
+		{`x = ""[0]`, "IndexError"},
+		{`x = "abc"[0.5]`, "TypeError"},
+		{`x = "ab"->repeat(-1)`, "ValueError"},
+		{`x = "ab"->repeat(2 ** 62)`, "MemoryError"},
+	} {
+		err := New().Interpret([]byte(tt.source))
+		var exc *RuntimeException
+		if !errors.As(err, &exc) {
+			t.Errorf("Interpret(%q) = %v, want %s", tt.source, err, tt.name)
+			continue
+		}
+		if v, ok := exc.Value.(*Error); !ok || v.Name != tt.name {
+			t.Errorf("Interpret(%q) raised %v, want %s", tt.source, exc.Value, tt.name)
+		}
+	}
+}
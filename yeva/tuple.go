@@ -0,0 +1,47 @@
+package yeva
+
+import (
+	"reflect"
+	"slices"
+)
+
+var protoTuple Prototype = protoOf(map[Value]Value{
+	Str("length"): tupleMethod("length", func(t *Tuple) int {
+		return len(t.Elems)
+	}),
+	Str("index_of"): tupleMethod("index_of", func(e *Evaluator, t *Tuple, v Value) int {
+		return indexOf(e, t.Elems, v)
+	}),
+	Str("to_list"): tupleMethod("to_list", func(e *Evaluator, t *Tuple) *Array {
+		return newArray(e, slices.Clone(t.Elems))
+	}),
+})
+
+// nativeTuple makes a tuple of the values of an iterable, the first
+// value of each step for docs and other multi-value iterations.
+var nativeTuple = wrapFunc(reflect.ValueOf(func(e *Evaluator, from ...Value) (*Tuple, error) {
+	if len(from) > 1 {
+		return nil, newError("TypeError", "tuple() takes at most 1 argument")
+	}
+	elems := []Value{}
+	if len(from) > 0 {
+		if t, ok := from[0].(*Tuple); ok {
+			return t, nil
+		}
+		next := e.iterate(from[0])
+		for vals, ok := next(); ok; vals, ok = next() {
+			elems = append(elems, first(vals))
+		}
+	}
+	e.alloc(len(elems) * valueSize)
+	return &Tuple{Elems: elems}, nil
+}), "tuple")
+
+func isTuple(v Value) bool {
+	_, ok := v.(*Tuple)
+	return ok
+}
+
+func tupleMethod(name string, fn any) *NativeFunc {
+	return wrapMethod(name, "a tuple", isTuple, fn)
+}
@@ -3,7 +3,9 @@ package yeva
 import (
 	"fmt"
 	"math/rand/v2"
+	"reflect"
 	"strconv"
+	"strings"
 )
 
 type Value interface {
@@ -21,6 +23,10 @@ type Callable interface {
 	call(e *Evaluator, args []Value) []Value
 }
 
+// Iterator yields the values of one for loop step, ok is false once the
+// iteration is exhausted.
+type Iterator func() (vals []Value, ok bool)
+
 type None struct{}
 
 type Bool bool
@@ -30,40 +36,17 @@ type Num float64
 type Str string
 
 type Func struct {
-	Code    []astStmt
-	Params  []varName
+	Code    *funcCode
 	Closure *env
 	Name    string
+	module  *Doc // globals of the defining module, nil for the main script
 }
 
 func (f *Func) call(e *Evaluator, args []Value) []Value {
-	if len(args) < len(f.Params) {
-		for range len(f.Params) - len(args) {
-			args = append(args, None{})
-		}
-	}
-
-	encl := e.env
-	e.env = newEnv(f.Closure)
-	for i, param := range f.Params {
-		e.env.store[param] = args[i]
-	}
-
-	var ret []Value
-	func() {
-		defer catch(func(sig returnSignal) { ret = sig })
-
-		for _, stmt := range f.Code {
-			e.eval(stmt)
-		}
-	}()
-
-	e.env = encl
-
-	if ret != nil {
-		return ret
-	}
-	return one(None{})
+	e.push(f)
+	e.stack = append(e.stack, args...)
+	e.callFunc(f, len(args), wantAll)
+	return e.run(len(e.frames) - 1)
 }
 
 type NativeFunc struct {
@@ -72,7 +55,16 @@ type NativeFunc struct {
 }
 
 func (nf *NativeFunc) call(e *Evaluator, args []Value) []Value {
-	return nf.Code(e, args)
+	e.checkDepth()
+	e.frames = append(e.frames, &frame{
+		native:   nf,
+		base:     len(e.stack),
+		handlers: len(e.handlers),
+	})
+	vals := nf.Code(e, args)
+	e.frames = e.frames[:len(e.frames)-1]
+	e.epoch++ // Go code can change Globals
+	return vals
 }
 
 type Method struct {
@@ -85,30 +77,128 @@ func (m *Method) call(e *Evaluator, args []Value) []Value {
 	return m.method.call(e, args)
 }
 
+// Doc maps keys to values and keeps the keys in insertion order, pairs
+// are changed through Set and Delete. The zero Doc is empty and ready
+// to use. Frozen docs, made by freeze, can't be changed by scripts and
+// equal frozen docs with equal pairs.
 type Doc struct {
-	Pairs map[Value]Value
 	Proto *Prototype
+
+	pairs  map[Value]Value
+	keys   []Value            // keys in insertion order, nil where deleted
+	index  map[Value]int      // positions of the keys in keys
+	hashed map[uint64][]Value // keys compared by contents, by their hash
+	frozen bool
+	module bool // holds the globals of a module
 }
 
 func (d *Doc) Index(key Value) Value {
-	v, ok := d.Pairs[key]
-	if ok {
-		return v
+	return d.get(nil, key)
+}
+
+func (d *Doc) Prototype() *Prototype {
+	return d.Proto
+}
+
+// Array is a list of values indexed from 0, negative indices count
+// from the end.
+type Array struct {
+	Elems []Value
+}
+
+func (a *Array) Index(key Value) Value {
+	switch key := key.(type) {
+	case Num, Int, BigInt:
+		return a.Elems[a.index(key)]
+	case Str:
+		return protoArray.Index(key)
+	}
+	Raise(newError("TypeError", "list indices must be numbers, not %s", typeName(key)))
+	return nil
+}
+
+func (a *Array) Prototype() *Prototype {
+	return &protoArray
+}
+
+// index checks a script index into the array.
+func (a *Array) index(n Value) int {
+	return checkIndex("list", n, len(a.Elems))
+}
+
+// Tuple is an immutable list of values. Tuples of equal values are
+// equal, so they can be doc keys. Elems must not be changed once the
+// tuple is used.
+type Tuple struct {
+	Elems []Value
+}
+
+func (t *Tuple) Index(key Value) Value {
+	switch key := key.(type) {
+	case Num, Int, BigInt:
+		return t.Elems[checkIndex("tuple", key, len(t.Elems))]
+	case Str:
+		return protoTuple.Index(key)
 	}
-	if d.Proto != nil {
-		return (*d.Proto).Index(key)
+	Raise(newError("TypeError", "tuple indices must be numbers, not %s", typeName(key)))
+	return nil
+}
+
+func (t *Tuple) Prototype() *Prototype {
+	return &protoTuple
+}
+
+func checkIndex(kind string, n Value, length int) int {
+	i, ok := toIndex(n)
+	if !ok {
+		Raise(newError("TypeError", "%s index %v is not an integer", kind, n))
+	}
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		Raise(newError("IndexError", "%s index %v out of range", kind, n))
+	}
+	return i
+}
+
+// Error is raised by the runtime for failures scripts may want to tell
+// apart by name, like RecursionError.
+type Error struct {
+	Name    string
+	Message string
+}
+
+func (v *Error) Index(key Value) Value {
+	switch key {
+	case Str("name"):
+		return Str(v.Name)
+	case Str("message"):
+		return Str(v.Message)
 	}
 	return None{}
 }
 
-func (d *Doc) Prototype() *Prototype {
-	return d.Proto
+func (v *Error) Prototype() *Prototype {
+	return nil
+}
+
+func (v *Error) Error() string {
+	return v.String()
+}
+
+func newError(name, format string, a ...any) *Error {
+	return &Error{name, fmt.Sprintf(format, a...)}
 }
 
 type Box struct {
 	Setter func(key Value, value Value)
 	Getter func(key Value) Value
 	Proto  *Prototype
+	Iter   func() Iterator                     // can be nil
+	Slice  func(start, stop, step Value) Value // can be nil, bounds left out are None
+
+	bound reflect.Value // pointer to the struct made by Bind
 }
 
 func (b *Box) Index(key Value) Value {
@@ -129,12 +219,19 @@ func (b *Box) Prototype() *Prototype {
 func (v None) Type()        {}
 func (v Bool) Type()        {}
 func (v Num) Type()         {}
+func (v Int) Type()         {}
+func (v BigInt) Type()      {}
+func (v Decimal) Type()     {}
 func (v Str) Type()         {}
 func (v *Doc) Type()        {}
+func (v *Array) Type()      {}
+func (v *Tuple) Type()      {}
 func (v *Func) Type()       {}
 func (v *NativeFunc) Type() {}
 func (v *Box) Type()        {}
 func (v *Method) Type()     {}
+func (v *Error) Type()      {}
+func (v *Generator) Type()  {}
 
 func (v None) String() string { return "None" }
 func (v Bool) String() string {
@@ -144,20 +241,30 @@ func (v Bool) String() string {
 	return "False"
 }
 func (v Num) String() string {
-	return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	s := strconv.FormatFloat(float64(v), 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0" // floats don't look like integers
+	}
+	return s
 }
+func (v Int) String() string         { return strconv.FormatInt(int64(v), 10) }
+func (v BigInt) String() string      { return v.v.String() }
 func (v Str) String() string         { return string(v) }
 func (v *Doc) String() string        { return "[doc Doc]" }
+func (v *Array) String() string      { return "[array Array]" }
+func (v *Tuple) String() string      { return "[tuple Tuple]" }
 func (v *Func) String() string       { return "[func Func]" }
 func (v *NativeFunc) String() string { return "[native Func]" }
 func (v *Box) String() string        { return "[box Box]" }
 func (v *Method) String() string     { return fmt.Sprint(v.method) }
+func (v *Error) String() string      { return v.Name + ": " + v.Message }
+func (v *Generator) String() string  { return "[generator Generator]" }
 
 var nativePrintln = NativeFunc{
 	Name: "println",
 	Code: func(e *Evaluator, args []Value) []Value {
 		for i, arg := range args {
-			fmt.Print(arg)
+			fmt.Print(e.toStr(arg))
 			if i != len(args)-1 {
 				fmt.Print(" ")
 			}
@@ -174,16 +281,6 @@ var nativeRandom = NativeFunc{
 	},
 }
 
-var protoArray Prototype = &Doc{map[Value]Value{
-	Str("length"): &NativeFunc{
-		Name: "length",
-		Code: func(e *Evaluator, args []Value) []Value {
-			d := args[0].(*Doc)
-			return one(Num(len(d.Pairs)))
-		},
-	},
-}, nil}
-
 func isNone(val Value) bool {
 	_, ok := val.(None)
 	return ok
@@ -0,0 +1,51 @@
+package yeva
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// WrapFunc makes a native function of any Go function. Script arguments
+// are converted to the parameter types and a mismatch raises TypeError.
+// A first *Evaluator parameter gets the calling evaluator, variadic
+// parameters take the remaining arguments and a trailing error result
+// is raised, as is when it wraps an *Error. Other results are returned
+// as multiple values.
+func WrapFunc(fn any) (*NativeFunc, error) {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		return nil, fmt.Errorf("wrap func: %T is not a function", fn)
+	}
+	return wrapFunc(rv, funcName(rv)), nil
+}
+
+func funcName(fn reflect.Value) string {
+	name := runtime.FuncForPC(fn.Pointer()).Name()
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+func wrapFunc(fn reflect.Value, name string) *NativeFunc {
+	return &NativeFunc{
+		Name: name,
+		Code: func(e *Evaluator, args []Value) []Value {
+			return callGo(e, fn, name, nil, args)
+		},
+	}
+}
+
+// wrapMethod wraps a Go function taking the receiver of a prototype
+// method as its first argument.
+func wrapMethod(name, recv string, isRecv func(Value) bool, fn any) *NativeFunc {
+	rv := reflect.ValueOf(fn)
+	return &NativeFunc{
+		Name: name,
+		Code: func(e *Evaluator, args []Value) []Value {
+			if len(args) == 0 || !isRecv(args[0]) {
+				Raise(newError("TypeError", "%s() must be called on %s with '->'", name, recv))
+			}
+			return callGo(e, rv, name, args[0], args[1:])
+		},
+	}
+}
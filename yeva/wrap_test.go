@@ -0,0 +1,52 @@
+package yeva
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWrapFunc(t *testing.T) {
+	add, err := WrapFunc(func(a, b int) int { return a + b })
+	if err != nil {
+		t.Fatal(err)
+	}
+	join, _ := WrapFunc(func(sep string, parts ...string) string { return strings.Join(parts, sep) })
+	check, _ := WrapFunc(func(n float64) (float64, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n * 2, nil
+	})
+	split, _ := WrapFunc(func(m map[string]int) (int, int) { return m["a"], m["b"] })
+	lookup, _ := WrapFunc(func(e *Evaluator, name string) Value { return e.Globals[name] })
+	e := New()
+	e.Globals["add"] = add
+	e.Globals["join"] = join
+	e.Globals["check"] = check
+	e.Globals["split"] = split
+	e.Globals["lookup"] = lookup
+	err = e.Interpret([]byte(`
+y = "y"
+a, b = split({a: 1, b: 2})
+x = [add(1, 2), join("-", "a", "b"), check(1.5), a, b, lookup("y")]
+try:
+    check(-1)
+except as err:
+    x[6] = err.name + ": " + err.message
+try:
+    add("a", 1)
+except as err:
+    x[7] = err.name
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[3, "a-b", 3.0, 1, 2, "y", "RuntimeError: negative", "TypeError"]`
+	if got := show(e.Globals["x"]); got != want {
+		t.Errorf("x = %s, want %s", got, want)
+	}
+	if _, err := WrapFunc(3); err == nil {
+		t.Error("WrapFunc(3) didn't fail")
+	}
+}